@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sing3demons/go-service/constants"
+)
+
+// TokenSource return the access token to send, it is called for every request and should cache
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+type staticToken string
+
+func (t staticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+func StaticToken(token string) TokenSource {
+	return staticToken(token)
+}
+
+// invalidator is implemented by the token sources that can drop a token the target rejected
+type invalidator interface {
+	Invalidate()
+}
+
+// Bearer set the Authorization header from the token source. When the target answer 401 the token
+// is invalidated and the request is sent once more with a new token if its body can be replayed.
+func Bearer(source TokenSource) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			res, err := sendWithToken(next, req, source)
+			if err != nil || res.StatusCode != http.StatusUnauthorized {
+				return res, err
+			}
+
+			inv, ok := source.(invalidator)
+			if !ok || (req.Body != nil && req.GetBody == nil) {
+				return res, err
+			}
+			inv.Invalidate()
+
+			retry := cloneRequest(req)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return res, nil
+				}
+				retry.Body = body
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+			return sendWithToken(next, retry, source)
+		})
+	}
+}
+
+func sendWithToken(next http.RoundTripper, req *http.Request, source TokenSource) (*http.Response, error) {
+	token, err := source.Token(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("token: %w", err)
+	}
+
+	req = cloneRequest(req)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return next.RoundTrip(req)
+}
+
+type ClientCredentialsConfig struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// ExpiryDelta refresh the token before it expire, default 30s
+	ExpiryDelta time.Duration
+	// HTTPClient default is the shared pooled client
+	HTTPClient *http.Client
+}
+
+type clientCredentials struct {
+	cfg ClientCredentialsConfig
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// ClientCredentials fetch tokens with the OAuth2 client credentials grant and cache them until they expire
+func ClientCredentials(cfg ClientCredentialsConfig) TokenSource {
+	if cfg.ExpiryDelta <= 0 {
+		cfg.ExpiryDelta = 30 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = defaultHTTPClient
+	}
+	return &clientCredentials{cfg: cfg}
+}
+
+func (c *clientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(c.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(constants.ContentType, constants.ContentTypeForm)
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	res, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", newResponseError(res.StatusCode, res.Header, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint %s returned no access_token", c.cfg.TokenURL)
+	}
+
+	c.token = token.AccessToken
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - c.cfg.ExpiryDelta)
+	return c.token, nil
+}
+
+func (c *clientCredentials) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+}
@@ -0,0 +1,322 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoEndpoint is returned when the resolver did not return any endpoint yet
+var ErrNoEndpoint = errors.New("no endpoint available")
+
+type Strategy int
+
+const (
+	RoundRobin Strategy = iota
+	LeastOutstanding
+	Weighted
+)
+
+type BalancerConfig struct {
+	Resolver Resolver
+	Strategy Strategy
+	// Refresh is the resolve interval of the resolvers that are not a Watcher, default 30s
+	Refresh time.Duration
+	// EjectAfter consecutive failures remove an endpoint for EjectDuration, default 5
+	EjectAfter int
+	// EjectDuration default 30s
+	EjectDuration time.Duration
+}
+
+type endpointState struct {
+	Endpoint
+	url         *url.URL
+	outstanding atomic.Int64
+	failures    int
+	ejectedAt   time.Time
+	current     int
+}
+
+// Balancer pick an endpoint for every request, endpoints failing EjectAfter times in a row are ejected.
+// When every endpoint is ejected they are all used again rather than failing every request.
+// It implements the app Component interface so it can be started and stopped with app.Register.
+type Balancer struct {
+	cfg BalancerConfig
+
+	mu        sync.Mutex
+	endpoints []*endpointState
+	next      atomic.Uint64
+	resolved  bool
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewBalancer(cfg BalancerConfig) *Balancer {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = 30 * time.Second
+	}
+	if cfg.EjectAfter <= 0 {
+		cfg.EjectAfter = 5
+	}
+	if cfg.EjectDuration <= 0 {
+		cfg.EjectDuration = 30 * time.Second
+	}
+	return &Balancer{cfg: cfg}
+}
+
+// Start resolve the endpoints then keep them up to date in the background
+func (b *Balancer) Start(ctx context.Context) error {
+	if err := b.refresh(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.done = make(chan struct{})
+
+	go func() {
+		defer close(b.done)
+
+		if w, ok := b.cfg.Resolver.(Watcher); ok {
+			w.Watch(ctx, b.update)
+			return
+		}
+
+		ticker := time.NewTicker(b.cfg.Refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := b.refresh(ctx); err != nil {
+					log.Println("balancer resolve error:", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *Balancer) Stop(ctx context.Context) error {
+	if b.cancel == nil {
+		return nil
+	}
+	b.cancel()
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Balancer) refresh(ctx context.Context) error {
+	endpoints, err := b.cfg.Resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	b.update(endpoints)
+	return nil
+}
+
+// update replace the endpoints, the state of the endpoints that are kept is preserved
+func (b *Balancer) update(endpoints []Endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	previous := make(map[string]*endpointState, len(b.endpoints))
+	for _, e := range b.endpoints {
+		previous[e.Addr] = e
+	}
+
+	states := make([]*endpointState, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.Weight == 0 {
+			continue
+		}
+		if s, ok := previous[e.Addr]; ok {
+			s.Weight = e.Weight
+			states = append(states, s)
+			continue
+		}
+		u, err := url.Parse(e.Addr)
+		if err != nil {
+			log.Println("balancer invalid endpoint:", e.Addr)
+			continue
+		}
+		states = append(states, &endpointState{Endpoint: e, url: u})
+	}
+
+	b.endpoints = states
+	b.resolved = true
+}
+
+// Endpoints return the current endpoints
+func (b *Balancer) Endpoints() []Endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	endpoints := make([]Endpoint, len(b.endpoints))
+	for i, e := range b.endpoints {
+		endpoints[i] = e.Endpoint
+	}
+	return endpoints
+}
+
+func (b *Balancer) pick(ctx context.Context) (*endpointState, error) {
+	b.mu.Lock()
+	resolved := b.resolved
+	b.mu.Unlock()
+
+	// used without app.Register, resolve once on first use
+	if !resolved {
+		if err := b.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]*endpointState, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		if e.ejectedAt.IsZero() || now.Sub(e.ejectedAt) >= b.cfg.EjectDuration {
+			healthy = append(healthy, e)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = b.endpoints
+	}
+	if len(healthy) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	start := int(b.next.Add(1) % uint64(len(healthy)))
+	switch b.cfg.Strategy {
+	case LeastOutstanding:
+		best := healthy[start]
+		for i := 1; i < len(healthy); i++ {
+			e := healthy[(start+i)%len(healthy)]
+			if e.outstanding.Load() < best.outstanding.Load() {
+				best = e
+			}
+		}
+		return best, nil
+	case Weighted:
+		// smooth weighted round robin, the same sequence as nginx
+		var best *endpointState
+		total := 0
+		for _, e := range healthy {
+			e.current += e.Weight
+			total += e.Weight
+			if best == nil || e.current > best.current {
+				best = e
+			}
+		}
+		best.current -= total
+		return best, nil
+	default:
+		return healthy[start], nil
+	}
+}
+
+// record count the consecutive failures of the endpoint and eject it when they reach EjectAfter
+func (b *Balancer) record(e *endpointState, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		e.failures = 0
+		e.ejectedAt = time.Time{}
+		return
+	}
+
+	e.failures++
+	if e.failures >= b.cfg.EjectAfter {
+		e.ejectedAt = time.Now()
+		e.failures = 0
+		log.Printf("balancer ejected %s for %s", e.Addr, b.cfg.EjectDuration)
+	}
+}
+
+// LoadBalance send every request to an endpoint of the balancer, the scheme and host of the
+// request url are replaced, the path of the endpoint is prepended to the request path and the query is kept
+func LoadBalance(b *Balancer) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			e, err := b.pick(req.Context())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", req.URL.Host, err)
+			}
+
+			req = cloneRequest(req)
+			e.rewrite(req.URL)
+			req.Host = ""
+
+			e.outstanding.Add(1)
+			res, err := next.RoundTrip(req)
+			e.outstanding.Add(-1)
+
+			if !errors.Is(err, context.Canceled) {
+				b.record(e, err != nil || res.StatusCode >= http.StatusInternalServerError)
+			}
+			return res, err
+		})
+	}
+}
+
+// rewrite point u to the endpoint, the path of the endpoint is a prefix of the path of u
+func (e *endpointState) rewrite(u *url.URL) {
+	u.Scheme = e.url.Scheme
+	u.Host = e.url.Host
+
+	prefix := strings.TrimSuffix(e.url.Path, "/")
+	if prefix == "" {
+		return
+	}
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimSuffix(e.url.EscapedPath(), "/") + u.RawPath
+	}
+	u.Path = prefix + u.Path
+}
+
+// HealthCheck report the target is up when one of the endpoints answer path without a 5xx,
+// it is meant for app.RegisterHealthCheck
+func (b *Balancer) HealthCheck(path string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		b.mu.Lock()
+		endpoints := slices.Clone(b.endpoints)
+		b.mu.Unlock()
+		if len(endpoints) == 0 {
+			return ErrNoEndpoint
+		}
+
+		var errs []error
+		for _, e := range endpoints {
+			u := &url.URL{Path: path}
+			e.rewrite(u)
+			err := HealthCheck(u.String())(ctx)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// WithBalancer send the requests of the client to the endpoints of b
+func WithBalancer(b *Balancer) ClientOption {
+	return WithInterceptors(LoadBalance(b))
+}
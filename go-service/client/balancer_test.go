@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestEndpointRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		request  string
+		want     string
+	}{
+		{"host only", "http://10.0.0.1:3000", "http://user-service/api/v1/users?id=1", "http://10.0.0.1:3000/api/v1/users?id=1"},
+		{"scheme replaced", "https://10.0.0.1", "http://user-service/api", "https://10.0.0.1/api"},
+		{"path prefix", "http://10.0.0.1:3000/users", "http://user-service/api/v1/login", "http://10.0.0.1:3000/users/api/v1/login"},
+		{"path prefix with trailing slash", "http://10.0.0.1:3000/users/", "http://user-service/api/v1/login", "http://10.0.0.1:3000/users/api/v1/login"},
+		{"path prefix and empty path", "http://10.0.0.1:3000/users", "http://user-service", "http://10.0.0.1:3000/users"},
+		{"escaped path", "http://10.0.0.1:3000/a%20b", "http://user-service/files/x%2Fy", "http://10.0.0.1:3000/a%20b/files/x%2Fy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &endpointState{url: mustParseURL(t, tt.endpoint)}
+			u := mustParseURL(t, tt.request)
+			e.rewrite(u)
+			if got := u.String(); got != tt.want {
+				t.Fatalf("rewrite() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBalancerEjection(t *testing.T) {
+	b := NewBalancer(BalancerConfig{
+		Resolver:      StaticResolver("http://a", "http://b"),
+		EjectAfter:    2,
+		EjectDuration: time.Minute,
+	})
+	ctx := context.Background()
+	if err := b.refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a := b.endpoints[0]
+
+	picked := func() map[string]int {
+		seen := map[string]int{}
+		for i := 0; i < 10; i++ {
+			e, err := b.pick(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen[e.Addr]++
+		}
+		return seen
+	}
+
+	// a success reset the consecutive failures
+	b.record(a, true)
+	b.record(a, false)
+	b.record(a, true)
+	if seen := picked(); seen["http://a"] == 0 {
+		t.Fatalf("endpoint ejected before EjectAfter consecutive failures: %v", seen)
+	}
+
+	b.record(a, true)
+	if seen := picked(); seen["http://a"] != 0 || seen["http://b"] != 10 {
+		t.Fatalf("ejected endpoint still picked: %v", seen)
+	}
+
+	// every endpoint ejected, they are all used again
+	b.record(b.endpoints[1], true)
+	b.record(b.endpoints[1], true)
+	if seen := picked(); seen["http://a"] == 0 || seen["http://b"] == 0 {
+		t.Fatalf("all endpoints ejected, want both picked: %v", seen)
+	}
+
+	// back after EjectDuration
+	b.mu.Lock()
+	b.endpoints[1].ejectedAt = time.Time{}
+	a.ejectedAt = time.Now().Add(-time.Minute)
+	b.mu.Unlock()
+	if seen := picked(); seen["http://a"] == 0 {
+		t.Fatalf("endpoint not restored after EjectDuration: %v", seen)
+	}
+}
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := parseEndpoints([]byte("# user-service\nhttp://10.0.0.1:3000/users/ 2\nhttp://10.0.0.2:3000 # default weight\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Endpoint{{Addr: "http://10.0.0.1:3000/users", Weight: 2}, {Addr: "http://10.0.0.2:3000", Weight: 1}}
+	if len(endpoints) != len(want) {
+		t.Fatalf("parseEndpoints() = %v, want %v", endpoints, want)
+	}
+	for i := range want {
+		if endpoints[i] != want[i] {
+			t.Fatalf("parseEndpoints()[%d] = %v, want %v", i, endpoints[i], want[i])
+		}
+	}
+
+	if _, err := parseEndpoints([]byte("10.0.0.1:3000\n")); err == nil {
+		t.Fatal("parseEndpoints() accepted an endpoint without scheme")
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,304 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrCircuitOpen is returned without calling the target while its breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is the error returned by Allow, it wraps ErrCircuitOpen
+type CircuitOpenError struct {
+	Name string
+	// RetryAfter is the time until the breaker let trial calls through
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, ErrCircuitOpen)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+type BreakerConfig struct {
+	// Name is the key of the breaker, default is the System, Name and url path of the ServiceConfig
+	Name string
+	// WindowSize is the number of last calls the rates are computed on, default 20
+	WindowSize int
+	// MinCalls is the number of calls before the breaker can open, default 10
+	MinCalls int
+	// FailureRate open the breaker when reached, default 0.5
+	FailureRate float64
+	// SlowCallDuration mark a successful call as slow, default 5s
+	SlowCallDuration time.Duration
+	// SlowCallRate open the breaker when reached, default 1 (only slow calls)
+	SlowCallRate float64
+	// OpenTimeout is the time the breaker stay open before letting trial calls through, default 30s
+	OpenTimeout time.Duration
+	// HalfOpenCalls is the number of trial calls, all of them must succeed to close the breaker, default 3
+	HalfOpenCalls int
+	// IsFailure default is an error or a 5xx status, the caller canceling is not a failure
+	IsFailure func(res HttpResponse, err error) bool
+}
+
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.WindowSize <= 0 {
+		c.WindowSize = 20
+	}
+	if c.MinCalls <= 0 {
+		c.MinCalls = 10
+	}
+	if c.MinCalls > c.WindowSize {
+		c.MinCalls = c.WindowSize
+	}
+	if c.FailureRate <= 0 {
+		c.FailureRate = 0.5
+	}
+	if c.SlowCallDuration <= 0 {
+		c.SlowCallDuration = 5 * time.Second
+	}
+	if c.SlowCallRate <= 0 {
+		c.SlowCallRate = 1
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenCalls <= 0 {
+		c.HalfOpenCalls = 3
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = func(res HttpResponse, err error) bool {
+			if errors.Is(err, context.Canceled) {
+				return false
+			}
+			return err != nil || res.StatusCode >= http.StatusInternalServerError
+		}
+	}
+	return c
+}
+
+var (
+	breakerStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "client_circuit_breaker_state",
+		Help: "State of the circuit breaker, 0 closed, 1 open, 2 half-open.",
+	}, []string{"name"})
+	breakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_circuit_breaker_transitions_total",
+		Help: "Number of circuit breaker state changes.",
+	}, []string{"name", "from", "to"})
+	breakerCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_circuit_breaker_calls_total",
+		Help: "Number of calls seen by the circuit breaker by result (success, failure, slow, rejected).",
+	}, []string{"name", "result"})
+)
+
+// BreakerMetrics return the collectors to register on the application registry
+func BreakerMetrics() []prometheus.Collector {
+	return []prometheus.Collector{breakerStateGauge, breakerTransitions, breakerCalls}
+}
+
+type outcome struct {
+	failure bool
+	slow    bool
+}
+
+type CircuitBreaker struct {
+	name string
+	cfg  BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	window   []outcome
+	next     int
+	openedAt time.Time
+	trials   int
+	passed   int
+}
+
+var breakers = struct {
+	sync.Mutex
+	m map[string]*CircuitBreaker
+}{m: map[string]*CircuitBreaker{}}
+
+// Breaker return the breaker of name, it is created with cfg on first use and shared afterwards
+func Breaker(name string, cfg BreakerConfig) *CircuitBreaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	if b, ok := breakers.m[name]; ok {
+		return b
+	}
+	b := &CircuitBreaker{name: name, cfg: cfg.withDefaults()}
+	breakers.m[name] = b
+	breakerStateGauge.WithLabelValues(name).Set(float64(StateClosed))
+	return b
+}
+
+// OpenBreakers return the names of the breakers that are not closed
+func OpenBreakers() []string {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	var names []string
+	for name, b := range breakers.m {
+		if b.State() != StateClosed {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BreakerHealthCheck fail while a breaker is open or half-open, register it as non-critical
+// so readiness report DEGRADED instead of taking the instance out
+func BreakerHealthCheck() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if names := OpenBreakers(); len(names) > 0 {
+			return fmt.Errorf("circuit breaker open: %s", strings.Join(names, ", "))
+		}
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) Name() string {
+	return b.name
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	return b.state
+}
+
+// Allow return a CircuitOpenError when the call must not be made, every allowed call must be followed by Record
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+
+	switch b.state {
+	case StateOpen:
+		breakerCalls.WithLabelValues(b.name, "rejected").Inc()
+		return &CircuitOpenError{Name: b.name, RetryAfter: b.cfg.OpenTimeout - time.Since(b.openedAt)}
+	case StateHalfOpen:
+		if b.trials >= b.cfg.HalfOpenCalls {
+			breakerCalls.WithLabelValues(b.name, "rejected").Inc()
+			// the trial calls decide soon, the caller can come back in a second
+			return &CircuitOpenError{Name: b.name, RetryAfter: time.Second}
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// Record the result of an allowed call
+func (b *CircuitBreaker) Record(res HttpResponse, err error, duration time.Duration) {
+	o := outcome{
+		failure: b.cfg.IsFailure(res, err),
+		slow:    duration >= b.cfg.SlowCallDuration,
+	}
+
+	result := "success"
+	if o.failure {
+		result = "failure"
+	} else if o.slow {
+		result = "slow"
+	}
+	breakerCalls.WithLabelValues(b.name, result).Inc()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		if o.failure || o.slow {
+			b.transition(StateOpen)
+			return
+		}
+		b.passed++
+		if b.passed >= b.cfg.HalfOpenCalls {
+			b.transition(StateClosed)
+		}
+	case StateClosed:
+		if len(b.window) < b.cfg.WindowSize {
+			b.window = append(b.window, o)
+		} else {
+			b.window[b.next] = o
+			b.next = (b.next + 1) % b.cfg.WindowSize
+		}
+		if b.tripped() {
+			b.transition(StateOpen)
+		}
+	}
+}
+
+func (b *CircuitBreaker) tripped() bool {
+	if len(b.window) < b.cfg.MinCalls {
+		return false
+	}
+
+	var failures, slow int
+	for _, o := range b.window {
+		if o.failure {
+			failures++
+		} else if o.slow {
+			slow++
+		}
+	}
+	total := float64(len(b.window))
+	return float64(failures)/total >= b.cfg.FailureRate || float64(slow)/total >= b.cfg.SlowCallRate
+}
+
+// expire move an open breaker to half-open once OpenTimeout elapsed, the lock must be held
+func (b *CircuitBreaker) expire() {
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cfg.OpenTimeout {
+		b.transition(StateHalfOpen)
+	}
+}
+
+// transition change the state and reset the counters, the lock must be held
+func (b *CircuitBreaker) transition(to BreakerState) {
+	from := b.state
+	b.state = to
+	b.window = b.window[:0]
+	b.next = 0
+	b.trials = 0
+	b.passed = 0
+	if to == StateOpen {
+		b.openedAt = time.Now()
+	}
+
+	breakerStateGauge.WithLabelValues(b.name).Set(float64(to))
+	breakerTransitions.WithLabelValues(b.name, from.String(), to.String()).Inc()
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	cfg := BreakerConfig{
+		WindowSize:       4,
+		MinCalls:         4,
+		FailureRate:      0.5,
+		SlowCallDuration: time.Second,
+		OpenTimeout:      time.Minute,
+		HalfOpenCalls:    2,
+	}
+
+	// ops: ok, fail and slow are allowed calls, expire age the open breaker past OpenTimeout
+	tests := []struct {
+		name string
+		ops  []string
+		want []BreakerState
+	}{
+		{
+			name: "closed below min calls",
+			ops:  []string{"fail", "fail", "fail"},
+			want: []BreakerState{StateClosed, StateClosed, StateClosed},
+		},
+		{
+			name: "closed under failure rate",
+			ops:  []string{"ok", "ok", "ok", "fail"},
+			want: []BreakerState{StateClosed, StateClosed, StateClosed, StateClosed},
+		},
+		{
+			name: "open at failure rate",
+			ops:  []string{"ok", "fail", "ok", "fail"},
+			want: []BreakerState{StateClosed, StateClosed, StateClosed, StateOpen},
+		},
+		{
+			name: "open on slow calls",
+			ops:  []string{"slow", "slow", "slow", "slow"},
+			want: []BreakerState{StateClosed, StateClosed, StateClosed, StateOpen},
+		},
+		{
+			name: "closed after successful trials",
+			ops:  []string{"fail", "fail", "fail", "fail", "expire", "ok", "ok"},
+			want: []BreakerState{StateClosed, StateClosed, StateClosed, StateOpen, StateHalfOpen, StateHalfOpen, StateClosed},
+		},
+		{
+			name: "open again on a failed trial",
+			ops:  []string{"fail", "fail", "fail", "fail", "expire", "ok", "fail"},
+			want: []BreakerState{StateClosed, StateClosed, StateClosed, StateOpen, StateHalfOpen, StateHalfOpen, StateOpen},
+		},
+		{
+			name: "open again on a slow trial",
+			ops:  []string{"fail", "fail", "fail", "fail", "expire", "slow"},
+			want: []BreakerState{StateClosed, StateClosed, StateClosed, StateOpen, StateHalfOpen, StateOpen},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Breaker(t.Name(), cfg)
+
+			for i, op := range tt.ops {
+				if op == "expire" {
+					b.mu.Lock()
+					b.openedAt = time.Now().Add(-cfg.OpenTimeout)
+					b.mu.Unlock()
+				} else {
+					if err := b.Allow(); err != nil {
+						t.Fatalf("op %d %s: Allow() = %v", i, op, err)
+					}
+					res := HttpResponse{StatusCode: http.StatusOK}
+					duration := time.Millisecond
+					switch op {
+					case "fail":
+						res.StatusCode = http.StatusServiceUnavailable
+					case "slow":
+						duration = cfg.SlowCallDuration
+					}
+					b.Record(res, nil, duration)
+				}
+
+				if got := b.State(); got != tt.want[i] {
+					t.Fatalf("op %d %s: State() = %s, want %s", i, op, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerRejects(t *testing.T) {
+	cfg := BreakerConfig{WindowSize: 2, MinCalls: 2, OpenTimeout: time.Minute, HalfOpenCalls: 1}
+	b := Breaker(t.Name(), cfg)
+
+	for i := 0; i < 2; i++ {
+		b.Allow()
+		b.Record(HttpResponse{}, errors.New("connection refused"), time.Millisecond)
+	}
+
+	err := b.Allow()
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) {
+		t.Fatalf("Allow() on open breaker = %v, want a CircuitOpenError", err)
+	}
+	if openErr.RetryAfter <= 0 || openErr.RetryAfter > cfg.OpenTimeout {
+		t.Fatalf("RetryAfter = %s, want in (0, %s]", openErr.RetryAfter, cfg.OpenTimeout)
+	}
+
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-cfg.OpenTimeout)
+	b.mu.Unlock()
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("first trial Allow() = %v, want nil", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() beyond HalfOpenCalls = %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestCircuitBreakerIgnoresCanceledCalls(t *testing.T) {
+	b := Breaker(t.Name(), BreakerConfig{WindowSize: 2, MinCalls: 2})
+
+	for i := 0; i < 4; i++ {
+		b.Allow()
+		b.Record(HttpResponse{}, fmt.Errorf("call: %w", context.Canceled), time.Millisecond)
+	}
+	if got := b.State(); got != StateClosed {
+		t.Fatalf("State() = %s, want %s", got, StateClosed)
+	}
+}
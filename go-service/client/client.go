@@ -4,14 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,7 +26,16 @@ type ServiceConfig struct {
 	Url        string
 	System     string
 	Timeout    int
-	StatusCode string
+	StatusCode string // no longer set as the config is shared, read HttpResponse.StatusCode
+	// Retry send the request again on transient failures, nil make a single attempt
+	Retry *RetryPolicy
+	// Breaker stop calling the target while it fails, breakers are keyed by System, Name and url path
+	// unless BreakerConfig.Name is set
+	Breaker *BreakerConfig
+	// Fallback is called with the error of a failed call, including ErrCircuitOpen, its result is returned instead
+	Fallback func(ctx context.Context, err error) (HttpResponse, error)
+
+	httpClient *http.Client
 }
 
 type BasicAuth struct {
@@ -36,8 +46,11 @@ type BasicAuth struct {
 type HttpMap map[string]string
 
 type Option struct {
-	Body   HttpMap
-	Query  HttpMap
+	// Body is encoded with Encoder, JSON by default
+	Body    any
+	Encoder Encoder
+	Query   HttpMap
+	// Param fill the {name} placeholders of the url
 	Param  HttpMap
 	Header HttpMap
 }
@@ -80,58 +93,123 @@ func NewHttp(config *ServiceConfig) serviceConfig {
 }
 
 func (cfg *ServiceConfig) Call(ctx context.Context, option Option) (HttpResponse, error) {
-	startTime := time.Now()
-	invokeId := logger.GetInvoke(ctx)
+	return cfg.Send(ctx, option.request())
+}
+
+// Send make the call described by r, the ServiceConfig is never modified
+func (cfg *ServiceConfig) Send(ctx context.Context, r Request) (HttpResponse, error) {
+	response, err := cfg.call(ctx, r)
+	if err != nil && cfg.Fallback != nil {
+		return cfg.Fallback(ctx, err)
+	}
+	return response, err
+}
+
+func (cfg *ServiceConfig) call(ctx context.Context, r Request) (HttpResponse, error) {
+	req, err := r.build(cfg)
+	if err != nil {
+		return HttpResponse{}, err
+	}
+
 	hostName, _ := os.Hostname()
 	summaryLog := logger.Summary{
 		Hostname: hostName,
 		Appname:  cfg.Name,
-		Ssid:     cfg.Url,
-		Intime:   startTime.Format(time.RFC3339),
-		Invoke:   invokeId,
+		Ssid:     req.url,
+		Invoke:   logger.GetInvoke(ctx),
+		Input:    req.input,
 	}
 
-	client := &http.Client{
-		Timeout: time.Duration(cfg.Timeout) * time.Millisecond,
+	if cfg.Retry == nil || cfg.Retry.MaxAttempts <= 1 {
+		return cfg.attempt(ctx, 1, summaryLog, req)
 	}
 
-	if len(option.Query) > 0 {
-		query := url.Values{}
-		for k, v := range option.Query {
-			query.Add(k, v)
+	policy := cfg.Retry.withDefaults()
+	for attempt := 1; ; attempt++ {
+		response, err := cfg.attempt(ctx, attempt, summaryLog, req)
+
+		delay, retry := policy.shouldRetry(attempt, response, err)
+		if !retry || !policy.retryable(req.method, req.header) {
+			return response, err
+		}
+		// give up when the next attempt cannot start before the deadline
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return response, err
 		}
-		cfg.Url = fmt.Sprintf("%s?%s", cfg.Url, query.Encode())
-		summaryLog.Input = ParseString(query)
-	}
 
-	// Replace URL Parameters
-	if len(option.Param) > 0 {
-		for k, v := range option.Param {
-			cfg.Url = strings.Replace(cfg.Url, k, v, 1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, err
+		case <-timer.C:
 		}
-		summaryLog.Input = ParseString(option.Param)
+		clientRetries.WithLabelValues(cfg.Name).Inc()
 	}
+}
 
-	// Build Request Body
-	var bodyReader io.Reader
-	if len(option.Body) > 0 {
-		body, err := json.Marshal(option.Body)
-		if err != nil {
+// breakerName return the key of the breaker of the target
+func (cfg *ServiceConfig) breakerName() string {
+	if cfg.Breaker.Name != "" {
+		return cfg.Breaker.Name
+	}
+	name := cfg.System + ":" + cfg.Name
+	if u, err := url.Parse(cfg.Url); err == nil && u.Path != "" {
+		name += ":" + u.Path
+	}
+	return name
+}
+
+// attempt send one request, every attempt has its own summary log and timeout
+func (cfg *ServiceConfig) attempt(ctx context.Context, attempt int, summaryLog logger.Summary, r *builtRequest) (response HttpResponse, err error) {
+	startTime := time.Now()
+	if cfg.Breaker != nil {
+		breaker := Breaker(cfg.breakerName(), *cfg.Breaker)
+		if err := breaker.Allow(); err != nil {
 			return HttpResponse{}, err
 		}
-		bodyReader = bytes.NewReader(body)
-		summaryLog.Input = string(body)
+		defer func() {
+			breaker.Record(response, err, time.Since(startTime))
+		}()
+	}
+	done := track(cfg.Name, r.method)
+	defer func() {
+		done(response.StatusCode, err)
+	}()
+	summaryLog.Intime = startTime.Format(time.RFC3339)
+	summaryLog.Attempt = attempt
+
+	// the call must finish within the remaining budget of the incoming request,
+	// a Timeout of 0 leave only the deadline of the caller
+	timeout := time.Duration(cfg.Timeout) * time.Millisecond
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return HttpResponse{}, fmt.Errorf("call %s:%s: %w", cfg.System, cfg.Name, context.DeadlineExceeded)
+		}
+		if timeout <= 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	// Create New HTTP Request
-	req, err := http.NewRequestWithContext(ctx, cfg.Method, cfg.Url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, bodyReader(r.body))
 	if err != nil {
 		return HttpResponse{}, err
 	}
 
 	// Add Headers
+	req.Header = r.header.Clone()
 	req.Header.Add("x-api-service", cfg.Name)
-	setHeaders(req, option.Header)
+	propagate(ctx, &summaryLog, req.Header)
+	if timeout > 0 {
+		req.Header.Set(constants.RequestTimeout, strconv.FormatInt(timeout.Milliseconds(), 10))
+	}
 
 	// Channel for HTTP response and error
 	ch := make(chan *http.Response, 1)
@@ -139,7 +217,7 @@ func (cfg *ServiceConfig) Call(ctx context.Context, option Option) (HttpResponse
 
 	// Perform HTTP call asynchronously
 	go func() {
-		res, err := client.Do(req)
+		res, err := cfg.client().Do(req)
 		if err != nil {
 			serviceError <- err
 			return
@@ -156,9 +234,8 @@ func (cfg *ServiceConfig) Call(ctx context.Context, option Option) (HttpResponse
 		if err != nil {
 			return HttpResponse{}, err
 		}
-		cfg.StatusCode = ParseString(result.StatusCode)
 
-		response := HttpResponse{
+		response = HttpResponse{
 			StatusCode: result.StatusCode,
 			Body:       body,
 			Header:     result.Header,
@@ -174,12 +251,42 @@ func (cfg *ServiceConfig) Call(ctx context.Context, option Option) (HttpResponse
 		go logger.ToSummaryLog(summaryLog)
 		return response, nil
 	case err := <-serviceError:
+		cfg.logAttemptError(summaryLog, startTime, err)
 		return HttpResponse{}, err
 	case <-ctx.Done():
-		return HttpResponse{}, fmt.Errorf("call %s:%s timeout %dms", cfg.System, cfg.Name, cfg.Timeout)
+		err := fmt.Errorf("call %s:%s: %w", cfg.System, cfg.Name, ctx.Err())
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("call %s:%s timeout %dms: %w", cfg.System, cfg.Name, timeout.Milliseconds(), ctx.Err())
+		}
+		cfg.logAttemptError(summaryLog, startTime, err)
+		return HttpResponse{}, err
 	}
 }
 
+func (cfg *ServiceConfig) logAttemptError(summaryLog logger.Summary, startTime time.Time, err error) {
+	endTime := time.Now()
+	summaryLog.Output = err.Error()
+	summaryLog.Outtime = endTime.Format(time.RFC3339)
+	summaryLog.DiffTime = endTime.Sub(startTime).Milliseconds()
+	go logger.ToSummaryLog(summaryLog)
+}
+
+// client return the pooled http client, the timeouts are applied through the request context
+func (cfg *ServiceConfig) client() *http.Client {
+	if cfg.httpClient != nil {
+		return cfg.httpClient
+	}
+	return defaultHTTPClient
+}
+
+// bodyReader return an untyped nil for an empty body, http.NewRequest treat a typed nil reader as a body
+func bodyReader(body []byte) io.Reader {
+	if body == nil {
+		return nil
+	}
+	return bytes.NewReader(body)
+}
+
 func cleanedString(body []byte) string {
 	cleanedString := strings.ReplaceAll(string(body), "  ", " ")
 	cleanedString = regexp.MustCompile(`([a-zA-Z])([A-Z])`).ReplaceAllString(cleanedString, "$1 $2")
@@ -191,22 +298,6 @@ func ParseString(data any) string {
 	return string(b)
 }
 
-type FormFile struct {
-	Name       string
-	File       multipart.File
-	FileHeader *multipart.FileHeader
-}
-
-type FormFields map[string]string
-
-type OptionPostForm struct {
-	URL       string
-	Timeout   time.Duration
-	FormFiles []FormFile
-	Fields    FormFields
-	Headers   map[string]string
-}
-
 func setHeaders(req *http.Request, headers map[string]string, defaultContentType ...string) {
 	if len(defaultContentType) > 0 {
 		req.Header.Set(constants.ContentType, defaultContentType[0])
@@ -220,99 +311,3 @@ func setHeaders(req *http.Request, headers map[string]string, defaultContentType
 	}
 
 }
-
-func (cfg *ServiceConfig) PostForm(ctx context.Context, opt OptionPostForm) (result HttpResponse, err error) {
-	startTime := time.Now()
-	invokeId := logger.GetInvoke(ctx)
-	hostName, _ := os.Hostname()
-	summaryLog := logger.Summary{
-		Hostname: hostName,
-		Appname:  cfg.Name,
-		Ssid:     cfg.Url,
-		Intime:   startTime.Format(time.RFC3339),
-		Invoke:   invokeId,
-	}
-	payload, writer, err := createMultipartPayload(opt)
-	if err != nil {
-		log.Println("Error creating payload.", err)
-		return HttpResponse{}, err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, opt.URL, payload)
-	if err != nil {
-		log.Println("Error creating request.", err)
-		return HttpResponse{}, err
-	}
-
-	setHeaders(req, opt.Headers, writer.FormDataContentType())
-
-	if opt.Timeout == 0 {
-		opt.Timeout = 60
-	}
-	client := &http.Client{Timeout: opt.Timeout * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Error sending request.", err)
-		return HttpResponse{}, err
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Println("Error reading response.", err)
-		return HttpResponse{}, err
-	}
-
-	result = HttpResponse{
-		StatusCode: resp.StatusCode,
-		Body:       respBody,
-		Header:     resp.Header,
-		Host:       resp.Request.Host,
-	}
-
-	cleanedString := strings.ReplaceAll(string(respBody), "  ", " ")
-	cleanedString = regexp.MustCompile(`([a-zA-Z])([A-Z])`).ReplaceAllString(cleanedString, "$1 $2")
-	cleanedString = strings.ReplaceAll(cleanedString, "  ", " ")
-	summaryLog.Output = cleanedString
-	endTime := time.Now()
-	summaryLog.Outtime = endTime.Format(time.RFC3339)
-	duration := endTime.Sub(startTime)
-	summaryLog.DiffTime = duration.Milliseconds()
-	summaryLog.Status = resp.StatusCode
-
-	go logger.ToSummaryLog(summaryLog)
-
-	return result, nil
-}
-
-func createMultipartPayload(opt OptionPostForm) (*bytes.Buffer, *multipart.Writer, error) {
-	payload := new(bytes.Buffer)
-	writer := multipart.NewWriter(payload)
-	for _, formFile := range opt.FormFiles {
-		if formFile.Name == "" {
-			formFile.Name = "file"
-		}
-		part, err := writer.CreateFormFile(formFile.Name, formFile.FileHeader.Filename)
-		if err != nil {
-			log.Println("Error creating form file.", err)
-			return nil, nil, err
-		}
-		_, err = io.Copy(part, formFile.File)
-		if err != nil {
-			log.Println("Error copying file.", err)
-			return nil, nil, err
-		}
-		defer formFile.File.Close()
-	}
-	for key, value := range opt.Fields {
-		if err := writer.WriteField(key, value); err != nil {
-			log.Println("Error writing field.", err)
-			return nil, nil, err
-		}
-	}
-	if err := writer.Close(); err != nil {
-		log.Println("Error closing writer.", err)
-		return nil, nil, err
-	}
-	return payload, writer, nil
-}
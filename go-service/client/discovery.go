@@ -0,0 +1,201 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Endpoint is one instance of a target, Addr is a base url such as http://10.0.0.1:3000,
+// a path in Addr (http://10.0.0.1:3000/users) is a prefix of the request paths
+type Endpoint struct {
+	Addr   string
+	Weight int
+}
+
+// Resolver return the current endpoints of a target
+type Resolver interface {
+	Resolve(ctx context.Context) ([]Endpoint, error)
+}
+
+// Watcher is implemented by the resolvers that push changes, Watch block until ctx is done
+type Watcher interface {
+	Watch(ctx context.Context, update func([]Endpoint))
+}
+
+type staticResolver []Endpoint
+
+func (r staticResolver) Resolve(ctx context.Context) ([]Endpoint, error) {
+	return r, nil
+}
+
+// StaticResolver return always the same endpoints
+func StaticResolver(addrs ...string) Resolver {
+	endpoints := make(staticResolver, 0, len(addrs))
+	for _, addr := range addrs {
+		endpoints = append(endpoints, Endpoint{Addr: addr, Weight: 1})
+	}
+	return endpoints
+}
+
+type DNSConfig struct {
+	// Service and Proto select a SRV lookup of _service._proto.name, the A/AAAA records of Name are used otherwise
+	Service string
+	Proto   string
+	Name    string
+	// Port is used with A/AAAA records
+	Port int
+	// Scheme default http
+	Scheme string
+	// Resolver default net.DefaultResolver
+	Resolver *net.Resolver
+}
+
+type dnsResolver struct {
+	cfg DNSConfig
+}
+
+// DNSResolver resolve SRV records, their weights are used by the Weighted strategy, or A/AAAA records
+func DNSResolver(cfg DNSConfig) Resolver {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	if cfg.Proto == "" {
+		cfg.Proto = "tcp"
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = net.DefaultResolver
+	}
+	return &dnsResolver{cfg: cfg}
+}
+
+func (r *dnsResolver) Resolve(ctx context.Context) ([]Endpoint, error) {
+	if r.cfg.Service != "" {
+		_, records, err := r.cfg.Resolver.LookupSRV(ctx, r.cfg.Service, r.cfg.Proto, r.cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints := make([]Endpoint, 0, len(records))
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			weight := int(srv.Weight)
+			if weight == 0 {
+				weight = 1
+			}
+			endpoints = append(endpoints, Endpoint{
+				Addr:   r.cfg.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(srv.Port))),
+				Weight: weight,
+			})
+		}
+		return endpoints, nil
+	}
+
+	hosts, err := r.cfg.Resolver.LookupHost(ctx, r.cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]Endpoint, 0, len(hosts))
+	for _, host := range hosts {
+		addr := host
+		if r.cfg.Port > 0 {
+			addr = net.JoinHostPort(host, strconv.Itoa(r.cfg.Port))
+		} else if strings.Contains(host, ":") {
+			addr = "[" + host + "]"
+		}
+		endpoints = append(endpoints, Endpoint{Addr: r.cfg.Scheme + "://" + addr, Weight: 1})
+	}
+	return endpoints, nil
+}
+
+type fileResolver struct {
+	path     string
+	interval time.Duration
+}
+
+// FileResolver read one endpoint per line, "url [weight]", blank lines and # comments are ignored.
+// A weight of 0 drain the endpoint. The file is checked for changes every interval, default 1s,
+// so it can be edited while running.
+func FileResolver(path string, interval time.Duration) Resolver {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &fileResolver{path: path, interval: interval}
+}
+
+func (r *fileResolver) Resolve(ctx context.Context) ([]Endpoint, error) {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+	return parseEndpoints(data)
+}
+
+func (r *fileResolver) Watch(ctx context.Context, update func([]Endpoint)) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(r.path); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(r.path)
+		if err != nil || (info.ModTime().Equal(modTime) && info.Size() == size) {
+			continue
+		}
+		modTime, size = info.ModTime(), info.Size()
+
+		// a file being written may be invalid, the last good endpoints are kept
+		if endpoints, err := r.Resolve(ctx); err == nil {
+			update(endpoints)
+		}
+	}
+}
+
+func parseEndpoints(data []byte) ([]Endpoint, error) {
+	var endpoints []Endpoint
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		u, err := url.Parse(fields[0])
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("endpoints line %d: invalid url %q", line, fields[0])
+		}
+
+		weight := 1
+		if len(fields) > 1 {
+			weight, err = strconv.Atoi(fields[1])
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("endpoints line %d: invalid weight %q", line, fields[1])
+			}
+		}
+		endpoints = append(endpoints, Endpoint{Addr: u.Scheme + "://" + u.Host + strings.TrimSuffix(u.EscapedPath(), "/"), Weight: weight})
+	}
+	return endpoints, scanner.Err()
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// HealthCheck check a downstream target respond without a server error,
+// it can be registered with app.RegisterHealthCheck
+func HealthCheck(url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s respond status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type HMACConfig struct {
+	KeyID  string
+	Secret []byte
+	// Header carry the signature, default X-Signature. The key id and timestamp are sent in
+	// X-Signature-Key-Id and X-Signature-Timestamp
+	Header string
+}
+
+// HMACStringToSign return the canonical string signed by HMACSigner, the target rebuild it to verify:
+// method, request uri, unix timestamp and hex sha256 of the body separated by new lines
+func HMACStringToSign(method string, requestURI string, timestamp string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return method + "\n" + requestURI + "\n" + timestamp + "\n" + hex.EncodeToString(sum[:])
+}
+
+// HMACSigner sign every request with HMAC-SHA256, the signature is base64 encoded
+func HMACSigner(cfg HMACConfig) Interceptor {
+	if cfg.Header == "" {
+		cfg.Header = "X-Signature"
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			body, err := readBody(req)
+			if err != nil {
+				return nil, err
+			}
+
+			req = cloneRequest(req)
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			mac := hmac.New(sha256.New, cfg.Secret)
+			mac.Write([]byte(HMACStringToSign(req.Method, req.URL.RequestURI(), timestamp, body)))
+
+			req.Header.Set(cfg.Header, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			req.Header.Set("X-Signature-Key-Id", cfg.KeyID)
+			req.Header.Set("X-Signature-Timestamp", timestamp)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// readBody return the body without consuming the request, GetBody is used when available
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody == nil {
+		return io.ReadAll(req.Body)
+	}
+
+	rc, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
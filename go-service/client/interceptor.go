@@ -0,0 +1,106 @@
+package client
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/go-service/constants"
+)
+
+// Interceptor wrap the transport of a Client, like the app middlewares the first one is the outermost
+type Interceptor func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapt a function to http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wrap base with the interceptors
+func Chain(base http.RoundTripper, interceptors ...Interceptor) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		base = interceptors[i](base)
+	}
+	return base
+}
+
+// WithInterceptors add interceptors around the transport of the client
+func WithInterceptors(interceptors ...Interceptor) ClientOption {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// cloneRequest return a shallow copy with its own header, a RoundTripper must not modify the request it receive
+func cloneRequest(req *http.Request) *http.Request {
+	return req.Clone(req.Context())
+}
+
+// Logging log the method, url, status and duration of every request, logf default to log.Printf
+func Logging(logf func(format string, v ...any)) Interceptor {
+	if logf == nil {
+		logf = log.Printf
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			if err != nil {
+				logf("client %s %s error=%v duration=%s", req.Method, req.URL.Redacted(), err, time.Since(start))
+				return res, err
+			}
+			logf("client %s %s status=%d duration=%s", req.Method, req.URL.Redacted(), res.StatusCode, time.Since(start))
+			return res, err
+		})
+	}
+}
+
+// Observe call fn after every request, it is the hook for custom metrics
+func Observe(fn func(req *http.Request, res *http.Response, err error, duration time.Duration)) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			res, err := next.RoundTrip(req)
+			fn(req, res, err, time.Since(start))
+			return res, err
+		})
+	}
+}
+
+// PropagateHeaders copy the named headers of the incoming request, stored in the context by
+// middleware.Logger, to the outgoing request. Headers already set on the outgoing request are kept.
+// Credential headers are never copied, use Bearer to authenticate the outgoing request.
+func PropagateHeaders(names ...string) Interceptor {
+	names = slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+		return slices.ContainsFunc(constants.CredentialHeaders, func(h string) bool {
+			return strings.EqualFold(h, name)
+		})
+	})
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			incoming, _ := req.Context().Value(constants.HeadersKey).(http.Header)
+			if len(incoming) == 0 {
+				return next.RoundTrip(req)
+			}
+
+			req = cloneRequest(req)
+			for _, name := range names {
+				if req.Header.Get(name) != "" {
+					continue
+				}
+				if values := incoming.Values(name); len(values) > 0 {
+					req.Header[http.CanonicalHeaderKey(name)] = values
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	clientRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_requests_total",
+		Help: "Number of outgoing requests by target, method and status class.",
+	}, []string{"name", "method", "status_class"})
+	clientDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "client_request_duration_seconds",
+		Help:    "Duration of outgoing requests by target, method and status class.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"name", "method", "status_class"})
+	clientInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "client_requests_in_flight",
+		Help: "Number of outgoing requests waiting for a response.",
+	}, []string{"name"})
+	clientRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_retries_total",
+		Help: "Number of outgoing requests sent again by the retry policy.",
+	}, []string{"name"})
+	clientTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_timeouts_total",
+		Help: "Number of outgoing requests that timed out.",
+	}, []string{"name"})
+)
+
+// Metrics return the collectors of the outgoing requests to register on the application registry
+func Metrics() []prometheus.Collector {
+	return []prometheus.Collector{clientRequests, clientDuration, clientInFlight, clientRetries, clientTimeouts}
+}
+
+// track count a request in flight, the returned func record its result
+func track(name string, method string) func(status int, err error) {
+	start := time.Now()
+	inFlight := clientInFlight.WithLabelValues(name)
+	inFlight.Inc()
+
+	return func(status int, err error) {
+		inFlight.Dec()
+
+		class := statusClass(status, err)
+		clientRequests.WithLabelValues(name, method, class).Inc()
+		clientDuration.WithLabelValues(name, method, class).Observe(time.Since(start).Seconds())
+		if class == "timeout" {
+			clientTimeouts.WithLabelValues(name).Inc()
+		}
+	}
+}
+
+func statusClass(status int, err error) string {
+	if err != nil {
+		if isTimeout(err) {
+			return "timeout"
+		}
+		return "error"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,311 @@
+package client
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sing3demons/go-service/logger"
+)
+
+type FormFile struct {
+	Name       string
+	File       multipart.File
+	FileHeader *multipart.FileHeader
+	// Reader, Filename and Size are used when the file does not come from a multipart request,
+	// Size -1 or 0 means unknown and the upload is sent chunked
+	Reader   io.Reader
+	Filename string
+	Size     int64
+}
+
+func (f FormFile) reader() io.Reader {
+	if f.File != nil {
+		return f.File
+	}
+	return f.Reader
+}
+
+func (f FormFile) filename() string {
+	if f.FileHeader != nil {
+		return f.FileHeader.Filename
+	}
+	return f.Filename
+}
+
+func (f FormFile) size() int64 {
+	if f.FileHeader != nil {
+		return f.FileHeader.Size
+	}
+	if f.Size > 0 {
+		return f.Size
+	}
+	return -1
+}
+
+type FormFields map[string]string
+
+// ProgressFunc receive the bytes transferred so far and the total, total is -1 when unknown
+type ProgressFunc func(transferred int64, total int64)
+
+type OptionPostForm struct {
+	// URL default is the url of the ServiceConfig
+	URL string
+	// Timeout is a number of seconds, e.g. Timeout: 30 for 30s.
+	//
+	// Deprecated: use UploadTimeout.
+	Timeout time.Duration
+	// UploadTimeout of the whole upload, it take precedence over Timeout, default 60s
+	UploadTimeout time.Duration
+	FormFiles     []FormFile
+	Fields        FormFields
+	Headers       map[string]string
+	Progress      ProgressFunc
+}
+
+// PostForm stream a multipart form, the files are never held in memory and are closed once sent.
+// The request is cancelled with ctx and its deadline.
+func (cfg *ServiceConfig) PostForm(ctx context.Context, opt OptionPostForm) (result HttpResponse, err error) {
+	streaming := false
+	defer func() {
+		// the files are closed by the writer goroutine once it started
+		if !streaming {
+			closeFormFiles(opt.FormFiles)
+		}
+	}()
+
+	startTime := time.Now()
+	invokeId := logger.GetInvoke(ctx)
+	hostName, _ := os.Hostname()
+
+	url := opt.URL
+	if url == "" {
+		url = cfg.Url
+	}
+
+	summaryLog := logger.Summary{
+		Hostname: hostName,
+		Appname:  cfg.Name,
+		Ssid:     url,
+		Intime:   startTime.Format(time.RFC3339),
+		Invoke:   invokeId,
+		Input:    formInput(opt),
+	}
+
+	timeout := opt.UploadTimeout
+	if timeout <= 0 && opt.Timeout > 0 {
+		timeout = opt.Timeout * time.Second
+	}
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	// unblock the writer when the server answer before reading the whole body
+	defer pr.Close()
+	body := &progressWriter{w: pw, progress: opt.Progress}
+	writer := multipart.NewWriter(body)
+	total := multipartLength(opt, writer.Boundary())
+	body.total = total
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
+	if err != nil {
+		log.Println("Error creating request.", err)
+		return HttpResponse{}, err
+	}
+	req.ContentLength = total
+
+	setHeaders(req, opt.Headers, writer.FormDataContentType())
+	propagate(ctx, &summaryLog, req.Header)
+
+	streaming = true
+	go func() {
+		defer closeFormFiles(opt.FormFiles)
+		pw.CloseWithError(writeMultipart(writer, opt))
+	}()
+
+	done := track(cfg.Name, http.MethodPost)
+	resp, err := cfg.client().Do(req)
+	if err != nil {
+		done(0, err)
+		log.Println("Error sending request.", err)
+		cfg.logAttemptError(summaryLog, startTime, err)
+		return HttpResponse{}, err
+	}
+	done(resp.StatusCode, nil)
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("Error reading response.", err)
+		return HttpResponse{}, err
+	}
+
+	result = HttpResponse{
+		StatusCode: resp.StatusCode,
+		Body:       respBody,
+		Header:     resp.Header,
+		Host:       resp.Request.Host,
+	}
+
+	summaryLog.Output = cleanedString(respBody)
+	endTime := time.Now()
+	summaryLog.Outtime = endTime.Format(time.RFC3339)
+	summaryLog.DiffTime = endTime.Sub(startTime).Milliseconds()
+	summaryLog.Status = resp.StatusCode
+
+	go logger.ToSummaryLog(summaryLog)
+
+	return result, nil
+}
+
+// formInput describe the form for the summary log, file contents are not logged
+func formInput(opt OptionPostForm) string {
+	files := make([]string, 0, len(opt.FormFiles))
+	for _, f := range opt.FormFiles {
+		files = append(files, f.filename())
+	}
+	return ParseString(map[string]any{"fields": opt.Fields, "files": files})
+}
+
+// writeMultipart write the parts in a stable order so multipartLength match the body
+func writeMultipart(writer *multipart.Writer, opt OptionPostForm) error {
+	for _, formFile := range opt.FormFiles {
+		if formFile.Name == "" {
+			formFile.Name = "file"
+		}
+		part, err := writer.CreateFormFile(formFile.Name, formFile.filename())
+		if err != nil {
+			log.Println("Error creating form file.", err)
+			return err
+		}
+
+		if _, err := io.Copy(part, formFile.reader()); err != nil {
+			log.Println("Error copying file.", err)
+			return err
+		}
+	}
+
+	for _, key := range sortedKeys(opt.Fields) {
+		if err := writer.WriteField(key, opt.Fields[key]); err != nil {
+			log.Println("Error writing field.", err)
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// closeFormFiles close every file reader that is a Closer
+func closeFormFiles(files []FormFile) {
+	for _, f := range files {
+		if c, ok := f.reader().(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// multipartLength return the size of the body, or -1 when a file size is unknown
+func multipartLength(opt OptionPostForm, boundary string) int64 {
+	counter := &countWriter{}
+	writer := multipart.NewWriter(counter)
+	writer.SetBoundary(boundary)
+
+	var files int64
+	for _, formFile := range opt.FormFiles {
+		size := formFile.size()
+		if size < 0 {
+			return -1
+		}
+		files += size
+
+		if formFile.Name == "" {
+			formFile.Name = "file"
+		}
+		writer.CreateFormFile(formFile.Name, formFile.filename())
+	}
+	for _, key := range sortedKeys(opt.Fields) {
+		writer.WriteField(key, opt.Fields[key])
+	}
+	writer.Close()
+
+	return counter.n + files
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// progressWriter report the bytes written to w
+type progressWriter struct {
+	w        io.Writer
+	total    int64
+	n        int64
+	progress ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	if p.progress != nil {
+		p.progress(p.n, p.total)
+	}
+	return n, err
+}
+
+// Download stream the response body of r to w, it return the number of bytes written.
+// The call timeout only cover the response headers, the transfer is bounded by ctx.
+func (cfg *ServiceConfig) Download(ctx context.Context, r Request, w io.Writer, progress ProgressFunc) (int64, error) {
+	res, err := cfg.Stream(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	total, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		total = -1
+	}
+	return io.Copy(&progressWriter{w: w, total: total, progress: progress}, res.Body)
+}
+
+// DownloadFile stream the response body of r to path, the file is written next to path
+// and renamed once complete so a failed download never leave a partial file at path
+func (cfg *ServiceConfig) DownloadFile(ctx context.Context, r Request, path string, progress ProgressFunc) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.part")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := cfg.Download(ctx, r, tmp, progress)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sing3demons/go-service/constants"
+	"github.com/sing3demons/go-service/logger"
+)
+
+// propagate set the session and trace headers of ctx on the outgoing request, every call get its own
+// child span which is sent as the parent span of the target. A session set by the caller is kept.
+func propagate(ctx context.Context, summaryLog *logger.Summary, h http.Header) {
+	session, traceID, spanID, _ := logger.TraceContext(ctx)
+	if traceID == "" {
+		traceID = logger.NewTraceID()
+	}
+	childSpanID := logger.NewSpanID()
+
+	if session != "" && h.Get(string(constants.Session)) == "" {
+		h.Set(string(constants.Session), session)
+	}
+	h.Set(constants.TraceIDHeader, traceID)
+	h.Set(constants.ParentSpanIDHeader, childSpanID)
+	if traceparent := logger.FormatTraceparent(traceID, childSpanID); traceparent != "" {
+		h.Set(constants.TraceParent, traceparent)
+	}
+
+	summaryLog.TraceID = traceID
+	summaryLog.SpanID = childSpanID
+	summaryLog.ParentSpan = spanID
+}
@@ -0,0 +1,270 @@
+package client
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/sing3demons/go-service/constants"
+)
+
+// Encoder turn a request body into bytes
+type Encoder interface {
+	ContentType() string
+	Encode(body any) ([]byte, error)
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string { return constants.ContentTypeJSON }
+
+func (jsonEncoder) Encode(body any) ([]byte, error) {
+	return json.Marshal(body)
+}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) ContentType() string { return constants.ContentTypeXML }
+
+func (xmlEncoder) Encode(body any) ([]byte, error) {
+	return xml.Marshal(body)
+}
+
+type formEncoder struct{}
+
+func (formEncoder) ContentType() string { return constants.ContentTypeForm }
+
+// Encode accept url.Values, map[string]string, HttpMap and map[string][]string
+func (formEncoder) Encode(body any) ([]byte, error) {
+	values := url.Values{}
+	switch v := body.(type) {
+	case url.Values:
+		values = v
+	case map[string][]string:
+		values = v
+	case map[string]string:
+		for k, s := range v {
+			values.Set(k, s)
+		}
+	case HttpMap:
+		for k, s := range v {
+			values.Set(k, s)
+		}
+	default:
+		return nil, fmt.Errorf("form encoder: unsupported body %T", body)
+	}
+	return []byte(values.Encode()), nil
+}
+
+type rawEncoder struct {
+	contentType string
+}
+
+func (e rawEncoder) ContentType() string { return e.contentType }
+
+// Encode accept []byte, string and io.Reader
+func (rawEncoder) Encode(body any) ([]byte, error) {
+	switch v := body.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case io.Reader:
+		return io.ReadAll(v)
+	default:
+		return nil, fmt.Errorf("raw encoder: unsupported body %T", body)
+	}
+}
+
+var (
+	JSONEncoder Encoder = jsonEncoder{}
+	XMLEncoder  Encoder = xmlEncoder{}
+	FormEncoder Encoder = formEncoder{}
+)
+
+// RawEncoder send []byte, string or io.Reader bodies as they are
+func RawEncoder(contentType string) Encoder {
+	if contentType == "" {
+		contentType = constants.ContentTypeOctetStream
+	}
+	return rawEncoder{contentType: contentType}
+}
+
+// Request describe one call, every method return a modified copy so a Request can be shared
+// and extended safely. The url of the ServiceConfig is used when URL is not set.
+type Request struct {
+	method  string
+	url     string
+	params  map[string]string
+	query   url.Values
+	header  http.Header
+	body    any
+	encoder Encoder
+}
+
+func NewRequest() Request {
+	return Request{}
+}
+
+func (r Request) Method(method string) Request {
+	r.method = method
+	return r
+}
+
+// URL may contain {name} placeholders filled by Param
+func (r Request) URL(url string) Request {
+	r.url = url
+	return r
+}
+
+// Param fill the {name} placeholder of the url, the value is path escaped
+func (r Request) Param(name string, value string) Request {
+	r.params = maps.Clone(r.params)
+	if r.params == nil {
+		r.params = map[string]string{}
+	}
+	r.params[name] = value
+	return r
+}
+
+func (r Request) Query(name string, value string) Request {
+	q := url.Values{}
+	for k, v := range r.query {
+		q[k] = append([]string(nil), v...)
+	}
+	q.Add(name, value)
+	r.query = q
+	return r
+}
+
+func (r Request) Header(name string, value string) Request {
+	r.header = r.header.Clone()
+	if r.header == nil {
+		r.header = http.Header{}
+	}
+	r.header.Set(name, value)
+	return r
+}
+
+// Body set the body, it is encoded as JSON unless an encoder is given
+func (r Request) Body(body any, encoder ...Encoder) Request {
+	r.body = body
+	r.encoder = nil
+	if len(encoder) > 0 {
+		r.encoder = encoder[0]
+	}
+	return r
+}
+
+// request convert the legacy Option
+func (option Option) request() Request {
+	r := NewRequest()
+	for k, v := range option.Param {
+		r = r.Param(k, v)
+	}
+	for k, v := range option.Query {
+		r = r.Query(k, v)
+	}
+	for k, v := range option.Header {
+		r = r.Header(k, v)
+	}
+	if !isEmptyBody(option.Body) {
+		r = r.Body(option.Body, option.Encoder)
+	}
+	return r
+}
+
+// isEmptyBody report a body that must not be sent, a nil or empty map, slice or string
+// and a nil pointer, so a typed nil HttpMap is not encoded as null
+func isEmptyBody(body any) bool {
+	if body == nil {
+		return true
+	}
+	v := reflect.ValueOf(body)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// builtRequest is the resolved form of a Request, it is sent as is on every attempt
+type builtRequest struct {
+	method string
+	url    string
+	header http.Header
+	body   []byte
+	// input is recorded in the summary log
+	input string
+}
+
+func (r Request) build(cfg *ServiceConfig) (*builtRequest, error) {
+	b := &builtRequest{
+		method: r.method,
+		url:    r.url,
+		header: http.Header{},
+	}
+	if b.method == "" {
+		b.method = cfg.Method
+	}
+	if b.url == "" {
+		b.url = cfg.Url
+	}
+
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(b.url, "?") {
+			sep = "&"
+		}
+		b.url += sep + r.query.Encode()
+		b.input = ParseString(r.query)
+	}
+
+	if len(r.params) > 0 {
+		b.url = expandURL(b.url, r.params)
+		b.input = ParseString(r.params)
+	}
+
+	contentType := constants.ContentJson
+	if r.body != nil {
+		encoder := r.encoder
+		if encoder == nil {
+			encoder = JSONEncoder
+		}
+		body, err := encoder.Encode(r.body)
+		if err != nil {
+			return nil, err
+		}
+		b.body = body
+		b.input = string(body)
+		contentType = encoder.ContentType()
+	}
+
+	b.header.Set(constants.ContentType, contentType)
+	for k, v := range r.header {
+		b.header[k] = v
+	}
+	return b, nil
+}
+
+// expandURL replace {name} with the escaped value, a name without braces in the url is replaced as is
+// for the callers of the former Option.Param
+func expandURL(rawURL string, params map[string]string) string {
+	for k, v := range params {
+		placeholder := "{" + k + "}"
+		if strings.Contains(rawURL, placeholder) {
+			rawURL = strings.ReplaceAll(rawURL, placeholder, url.PathEscape(v))
+			continue
+		}
+		rawURL = strings.Replace(rawURL, k, v, 1)
+	}
+	return rawURL
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/go-service/constants"
+	"github.com/sing3demons/go-service/logger"
+)
+
+// ResponseError is returned for non-2xx responses, the standard envelope fields are filled when the body is one
+type ResponseError struct {
+	StatusCode       int
+	ResultCode       string
+	ResultDesc       string
+	DeveloperMessage string
+	Header           http.Header
+	Body             []byte
+}
+
+func (e *ResponseError) Error() string {
+	if e.ResultCode != "" {
+		return fmt.Sprintf("response status %d: %s %s", e.StatusCode, e.ResultCode, e.ResultDesc)
+	}
+	return fmt.Sprintf("response status %d", e.StatusCode)
+}
+
+// Envelope is the standard response of the services, use it as T to decode the data of the envelope
+type Envelope[T any] struct {
+	ResultCode       string `json:"resultCode"`
+	ResultDesc       string `json:"resultDesc"`
+	DeveloperMessage string `json:"developerMessage,omitempty"`
+	Data             T      `json:"data,omitempty"`
+}
+
+// CheckResponse return a *ResponseError when the status is not 2xx
+func CheckResponse(res HttpResponse) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	return newResponseError(res.StatusCode, res.Header, res.Body)
+}
+
+func newResponseError(status int, header http.Header, body []byte) *ResponseError {
+	e := &ResponseError{StatusCode: status, Header: header, Body: body}
+
+	var envelope Envelope[json.RawMessage]
+	if json.Unmarshal(body, &envelope) == nil {
+		e.ResultCode = envelope.ResultCode
+		e.ResultDesc = envelope.ResultDesc
+		e.DeveloperMessage = envelope.DeveloperMessage
+	}
+	return e
+}
+
+// Decode decode a 2xx response into T according to its content type, other responses return a *ResponseError
+func Decode[T any](res HttpResponse) (T, error) {
+	var out T
+	if err := CheckResponse(res); err != nil {
+		return out, err
+	}
+	if len(res.Body) == 0 {
+		return out, nil
+	}
+
+	if strings.Contains(res.Header.Get(constants.ContentType), "xml") {
+		return out, xml.Unmarshal(res.Body, &out)
+	}
+	return out, json.Unmarshal(res.Body, &out)
+}
+
+// Do send r and decode the response into T
+func Do[T any](ctx context.Context, c *Client, r Request, opts ...CallOption) (T, error) {
+	res, err := c.Send(ctx, r, opts...)
+	if err != nil {
+		var out T
+		return out, err
+	}
+	return Decode[T](res)
+}
+
+// StreamResponse is a response whose body is read by the caller, Body must be closed
+type StreamResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+// Stream send r without reading the response body, it is meant for large payloads.
+// The call timeout cover waiting for the response headers, reading the body is only bounded by ctx.
+// Non-2xx responses return a *ResponseError and are not retried.
+func (cfg *ServiceConfig) Stream(ctx context.Context, r Request) (response *StreamResponse, err error) {
+	req, err := r.build(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	hostName, _ := os.Hostname()
+	summaryLog := logger.Summary{
+		Hostname: hostName,
+		Appname:  cfg.Name,
+		Ssid:     req.url,
+		Invoke:   logger.GetInvoke(ctx),
+		Input:    req.input,
+		Intime:   startTime.Format(time.RFC3339),
+		Attempt:  1,
+	}
+
+	if cfg.Breaker != nil {
+		breaker := Breaker(cfg.breakerName(), *cfg.Breaker)
+		if err := breaker.Allow(); err != nil {
+			return nil, err
+		}
+		defer func() {
+			res := HttpResponse{}
+			if response != nil {
+				res.StatusCode = response.StatusCode
+			}
+			breaker.Record(res, err, time.Since(startTime))
+		}()
+	}
+
+	// the timer is stopped once the headers arrive so a long body is not cut by the call timeout
+	ctx, cancelCause := context.WithCancelCause(ctx)
+	cancel := func() { cancelCause(context.Canceled) }
+	// a Timeout of 0 leave only the deadline of the caller
+	stopHeaderTimer := func() bool { return true }
+	if cfg.Timeout > 0 {
+		headerTimer := time.AfterFunc(time.Duration(cfg.Timeout)*time.Millisecond, func() {
+			cancelCause(context.DeadlineExceeded)
+		})
+		stopHeaderTimer = headerTimer.Stop
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, req.url, bodyReader(req.body))
+	if err != nil {
+		stopHeaderTimer()
+		cancel()
+		return nil, err
+	}
+	httpReq.Header = req.header.Clone()
+	httpReq.Header.Add("x-api-service", cfg.Name)
+	propagate(ctx, &summaryLog, httpReq.Header)
+
+	done := track(cfg.Name, req.method)
+	res, err := cfg.client().Do(httpReq)
+	if !stopHeaderTimer() && err == nil {
+		// the timer fired while the headers arrived, the body context is already canceled
+		res.Body.Close()
+		err = context.Cause(ctx)
+	}
+	if err != nil {
+		if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			err = fmt.Errorf("call %s:%s timeout %dms: %w", cfg.System, cfg.Name, cfg.Timeout, context.DeadlineExceeded)
+		}
+		done(0, err)
+		cancel()
+		cfg.logAttemptError(summaryLog, startTime, err)
+		return nil, err
+	}
+	done(res.StatusCode, nil)
+	summaryLog.Status = res.StatusCode
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		defer cancel()
+		defer res.Body.Close()
+		// error bodies are small envelopes, they are not streamed
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		summaryLog.Output = cleanedString(body)
+		go logger.ToSummaryLog(summaryLog)
+		return &StreamResponse{StatusCode: res.StatusCode, Header: res.Header}, newResponseError(res.StatusCode, res.Header, body)
+	}
+
+	return &StreamResponse{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body: &streamBody{
+			ReadCloser:  res.Body,
+			cancel:      cancel,
+			summaryLog:  summaryLog,
+			contentType: res.Header.Get(constants.ContentType),
+		},
+	}, nil
+}
+
+// streamBody write the summary log with the number of bytes read once the caller close the body
+type streamBody struct {
+	io.ReadCloser
+	cancel      context.CancelFunc
+	summaryLog  logger.Summary
+	contentType string
+	n           int64
+	closed      bool
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	b.summaryLog.Output = fmt.Sprintf("<%d bytes %s>", b.n, b.contentType)
+	go logger.ToSummaryLog(b.summaryLog)
+	return err
+}
+
+// Stream send r without reading the response body, Body must be closed
+func (c *Client) Stream(ctx context.Context, r Request, opts ...CallOption) (*StreamResponse, error) {
+	cfg := c.config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg.Stream(ctx, r)
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sing3demons/go-service/constants"
+)
+
+type RetryPolicy struct {
+	// MaxAttempts include the first attempt, 1 or less disable retries
+	MaxAttempts int
+	// InitialBackoff default 100ms, it is multiplied by Multiplier after every attempt up to MaxBackoff
+	InitialBackoff time.Duration
+	// MaxBackoff default 2s
+	MaxBackoff time.Duration
+	// Multiplier default 2
+	Multiplier float64
+	// Jitter is the random fraction removed from every backoff, default 0.2
+	Jitter float64
+	// RetryOnStatus default 502, 503 and 504
+	RetryOnStatus []int
+	// RetryOnError default connection refused/reset, unexpected EOF and attempt timeouts
+	RetryOnError func(err error) bool
+	// AllowNonIdempotent retry POST and PATCH too, they are always retried when an Idempotency-Key header is sent
+	AllowNonIdempotent bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 2 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = 0.2
+	}
+	if len(p.RetryOnStatus) == 0 {
+		p.RetryOnStatus = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	if p.RetryOnError == nil {
+		p.RetryOnError = IsTransientError
+	}
+	return p
+}
+
+// backoff return the delay before the next attempt, attempt start at 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// retryable tell whether the request can be sent again
+func (p RetryPolicy) retryable(method string, header http.Header) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return p.AllowNonIdempotent || header.Get(constants.IdempotencyKey) != ""
+}
+
+// shouldRetry return the delay before the next attempt and whether there is one
+func (p RetryPolicy) shouldRetry(attempt int, res HttpResponse, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if err != nil {
+		if !p.RetryOnError(err) {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+
+	if !slices.Contains(p.RetryOnStatus, res.StatusCode) {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+	if after, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+		delay = after
+	}
+	return delay, true
+}
+
+// IsTransientError report connection failures and attempt timeouts, the caller context being done is not transient
+func IsTransientError(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// parseRetryAfter accept delay-seconds and http-date
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// Client is built once per target and shared by all the handlers, every call work on a copy of its
+// ServiceConfig so per-call options never change the shared state
+type Client struct {
+	config       ServiceConfig
+	http         *http.Client
+	interceptors []Interceptor
+}
+
+type ClientOption func(c *Client)
+
+// WithTransport use a dedicated transport instead of the shared default one
+func WithTransport(t http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.http = &http.Client{Transport: t}
+	}
+}
+
+// WithHTTPClient use an existing http.Client, its Timeout should be zero as the call timeout come from the context
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+func NewClient(config ServiceConfig, opts ...ClientOption) *Client {
+	c := &Client{http: defaultHTTPClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if len(c.interceptors) > 0 {
+		hc := *c.http
+		hc.Transport = Chain(hc.Transport, c.interceptors...)
+		c.http = &hc
+	}
+
+	NewHttp(&config)
+	config.httpClient = c.http
+	c.config = config
+	return c
+}
+
+// Config return a copy of the client configuration
+func (c *Client) Config() ServiceConfig {
+	return c.config
+}
+
+type CallOption func(cfg *ServiceConfig)
+
+// WithTimeout override the timeout of one call, in milliseconds
+func WithTimeout(ms int) CallOption {
+	return func(cfg *ServiceConfig) {
+		cfg.Timeout = ms
+	}
+}
+
+func WithMethod(method string) CallOption {
+	return func(cfg *ServiceConfig) {
+		cfg.Method = method
+	}
+}
+
+func WithURL(url string) CallOption {
+	return func(cfg *ServiceConfig) {
+		cfg.Url = url
+	}
+}
+
+func WithRetry(policy *RetryPolicy) CallOption {
+	return func(cfg *ServiceConfig) {
+		cfg.Retry = policy
+	}
+}
+
+func (c *Client) Call(ctx context.Context, option Option, opts ...CallOption) (HttpResponse, error) {
+	cfg := c.config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg.Call(ctx, option)
+}
+
+// Send make the call described by r, an empty url or method in r use the client ones
+func (c *Client) Send(ctx context.Context, r Request, opts ...CallOption) (HttpResponse, error) {
+	cfg := c.config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg.Send(ctx, r)
+}
+
+func (c *Client) PostForm(ctx context.Context, opt OptionPostForm, opts ...CallOption) (HttpResponse, error) {
+	cfg := c.config
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return cfg.PostForm(ctx, opt)
+}
+
+// Download stream the response body of r to w
+func (c *Client) Download(ctx context.Context, r Request, w io.Writer, progress ProgressFunc, opts ...CallOption) (int64, error) {
+	cfg := c.config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg.Download(ctx, r, w, progress)
+}
+
+// DownloadFile stream the response body of r to the file at path
+func (c *Client) DownloadFile(ctx context.Context, r Request, path string, progress ProgressFunc, opts ...CallOption) (int64, error) {
+	cfg := c.config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg.DownloadFile(ctx, r, path, progress)
+}
+
+// CloseIdleConnections release the pooled connections, it can be registered as an app component stop hook
+func (c *Client) CloseIdleConnections(ctx context.Context) error {
+	c.http.CloseIdleConnections()
+	return nil
+}
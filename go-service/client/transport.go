@@ -0,0 +1,78 @@
+package client
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type TransportConfig struct {
+	// MaxIdleConns across all hosts, default 100
+	MaxIdleConns int
+	// MaxIdleConnsPerHost default 20, the net/http default of 2 reopen connections under load
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limit active connections, 0 means no limit
+	MaxConnsPerHost int
+	// IdleConnTimeout default 90s
+	IdleConnTimeout time.Duration
+	// DialTimeout default 5s
+	DialTimeout time.Duration
+	// KeepAlive is the tcp keep-alive period, default 30s
+	KeepAlive time.Duration
+	// TLSHandshakeTimeout default 5s
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout 0 means only the call timeout apply
+	ResponseHeaderTimeout time.Duration
+	TLSConfig             *tls.Config
+	// Proxy default is http.ProxyFromEnvironment
+	Proxy func(*http.Request) (*url.URL, error)
+}
+
+// NewTransport build a transport meant to be shared by all the calls to keep connections alive
+func NewTransport(cfg TransportConfig) *http.Transport {
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = 100
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = 20
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = 90 * time.Second
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = 30 * time.Second
+	}
+	if cfg.TLSHandshakeTimeout <= 0 {
+		cfg.TLSHandshakeTimeout = 5 * time.Second
+	}
+	if cfg.Proxy == nil {
+		cfg.Proxy = http.ProxyFromEnvironment
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+	return &http.Transport{
+		Proxy:                 cfg.Proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       cfg.TLSConfig,
+	}
+}
+
+// defaultHTTPClient is used by the ServiceConfig that are not created by NewClient,
+// timeouts come from the call context so it has none
+var defaultHTTPClient = &http.Client{Transport: NewTransport(TransportConfig{})}
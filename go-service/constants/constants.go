@@ -3,10 +3,27 @@ package constants
 type ContextKey string
 
 const (
-	TraceIDKey      ContextKey = "trace_id"
-	SpanIDKey       ContextKey = "span_id"
-	Session         ContextKey = "session"
-	ContentType                = "Content-Type"
-	ContentTypeJSON            = "application/json"
-	ContentJson                = "application/json"
+	TraceIDKey             ContextKey = "trace_id"
+	SpanIDKey              ContextKey = "span_id"
+	ParentSpanIDKey        ContextKey = "parent_span_id"
+	HeadersKey             ContextKey = "request_headers"
+	Session                ContextKey = "session"
+	ContentType                       = "Content-Type"
+	ContentTypeJSON                   = "application/json"
+	ContentJson                       = "application/json"
+	ContentTypeXML                    = "application/xml"
+	ContentTypeMsgPack                = "application/msgpack"
+	ContentTypeText                   = "text/plain; charset=utf-8"
+	ContentTypeOctetStream            = "application/octet-stream"
+	ContentTypeEventStream            = "text/event-stream"
+	ContentTypeForm                   = "application/x-www-form-urlencoded"
+	Accept                            = "Accept"
+	RequestTimeout                    = "X-Request-Timeout"
+	IdempotencyKey                    = "Idempotency-Key"
+	TraceParent                       = "traceparent"
+	TraceIDHeader                     = "X-Trace-Id"
+	ParentSpanIDHeader                = "X-Parent-Span-Id"
 )
+
+// CredentialHeaders are never stored with the incoming headers nor propagated to other services
+var CredentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
@@ -27,6 +27,10 @@ type Summary struct {
 	Command    string    `json:"command"`
 	MenuId     string    `json:"menu_id"`
 	Channel    string    `json:"channel"`
+	Attempt    int       `json:"attempt,omitempty"`
+	TraceID    string    `json:"trace_id,omitempty"`
+	SpanID     string    `json:"span_id,omitempty"`
+	ParentSpan string    `json:"parent_span_id,omitempty"`
 }
 
 func ToSummaryLog(newSummaryLog Summary) {
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/sing3demons/go-service/constants"
+)
+
+// NewTraceID return a W3C trace id, 32 lowercase hex characters
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+// NewSpanID return a W3C span id, 16 lowercase hex characters
+func NewSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// FormatTraceparent build the W3C traceparent header, it return an empty string when the ids are not W3C ids
+func FormatTraceparent(traceID string, spanID string) string {
+	traceID = strings.ToLower(strings.ReplaceAll(traceID, "-", ""))
+	if !isHex(traceID, 32) || !isHex(spanID, 16) {
+		return ""
+	}
+	return "00-" + traceID + "-" + spanID + "-01"
+}
+
+// ParseTraceparent return the trace id and the parent span id of a W3C traceparent header
+func ParseTraceparent(v string) (traceID string, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", false
+	}
+	traceID, spanID = strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !isHex(traceID, 32) || !isHex(spanID, 16) ||
+		traceID == strings.Repeat("0", 32) || spanID == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// TraceContext return the session, trace, span and parent span ids stored in ctx by the Logger middleware
+func TraceContext(ctx context.Context) (session string, traceID string, spanID string, parentSpanID string) {
+	session, _ = ctx.Value(constants.Session).(string)
+	traceID, _ = ctx.Value(constants.TraceIDKey).(string)
+	spanID, _ = ctx.Value(constants.SpanIDKey).(string)
+	parentSpanID, _ = ctx.Value(constants.ParentSpanIDKey).(string)
+	return
+}
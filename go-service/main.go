@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/sing3demons/go-service/client"
 	"github.com/sing3demons/go-service/constants"
+	"github.com/sing3demons/go-service/middleware"
 	"github.com/sing3demons/go-service/ms"
 )
 
@@ -32,15 +37,48 @@ func init() {
 }
 
 func main() {
-	app := ms.NewApplication(ms.Config{
-		Addr: os.Getenv("PORT"),
-		Env:  os.Getenv("APP_ENV"),
-	})
+	cfg := ms.Config{
+		Addr:      os.Getenv("PORT"),
+		Env:       os.Getenv("APP_ENV"),
+		AdminAddr: os.Getenv("ADMIN_PORT"),
+		HTTP2:     true,
+		CORS: &middleware.CORSConfig{
+			AllowOrigins:  []string{"*"},
+			AllowHeaders:  []string{constants.ContentType, "Authorization", string(constants.Session)},
+			ExposeHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+		},
+		SecureHeaders:  &middleware.SecureHeadersConfig{},
+		MaxBodyBytes:   1 << 20, // 1MB
+		RequestTimeout: 10 * time.Second,
+		Compression:    &middleware.CompressConfig{},
+	}
+	if cfg.Env != "local" {
+		cfg.Health.DrainDelay = 5 * time.Second
+	}
+	app := ms.NewApplication(cfg)
 
-	authHandler := AuthHandler{
-		BaseURL: os.Getenv("USER_SERVICE_URL"),
-		Name:    os.Getenv("SERVICE_NAME"),
-		System:  "x-go-service",
+	// USER_SERVICE_ENDPOINTS is a file of user-service instances, it is watched so instances can be added while running
+	resolver := client.StaticResolver(os.Getenv("USER_SERVICE_URL"))
+	if path := os.Getenv("USER_SERVICE_ENDPOINTS"); path != "" {
+		resolver = client.FileResolver(path, 0)
+	}
+	balancer := client.NewBalancer(client.BalancerConfig{
+		Resolver: resolver,
+		Strategy: client.LeastOutstanding,
+	})
+	app.Register("user-service-balancer", balancer)
+
+	// the host of the clients is only a name, the balancer replace it with an endpoint from the resolver
+	authHandler := NewAuthHandler("http://user-service", os.Getenv("SERVICE_NAME"), "x-go-service", balancer)
+
+	// routes that opt in with middleware.JWT verify access tokens locally when the public key of user-service is available,
+	// /api/v1/auth/verify is always answered by user-service so revoked sessions are rejected
+	if os.Getenv("PUBLIC_KEY") != "" {
+		verifier, err := middleware.NewJWTVerifier(middleware.JWTConfig{PublicKeyEnv: "PUBLIC_KEY"})
+		if err != nil {
+			log.Fatalf("jwt verifier: %v", err)
+		}
+		authHandler.Verifier = verifier
 	}
 
 	servers := os.Getenv("KAFKA_SERVERS")
@@ -52,30 +90,52 @@ func main() {
 
 	topic := "client"
 	prod := ms.NewProducer(servers, app)
+	app.Register("kafka-producer", prod)
 
-	app.GET("/api/v1/health", func(c ms.HTTPContext) {
+	app.RegisterHealthCheck("kafka", app.KafkaHealthCheck(servers), false)
+	app.RegisterHealthCheck("user-service", balancer.HealthCheck("/"), false)
+
+	app.GET("/api/v1/health", app.Liveness)
+	app.POST("/api/v1/publish", func(c ms.HTTPContext) {
 		initInvoked := "init_invoked"
-		scenario := "curl -X GET 'http://localhost:8080/api/v1/health'"
+		scenario := "curl -X POST 'http://localhost:8080/api/v1/publish'"
 		detailLog := c.DetailLog(initInvoked, scenario, "client")
 		q := c.Req.URL.Query()
 
-		cmd := "get-health"
+		cmd := "publish"
 
 		data := map[string]string{"status": "ok"}
 		detailLog.AddInputRequest("client", cmd, initInvoked, nil, q)
 
-		detailLog.AddOutputRequest("client", cmd, initInvoked, "", data)
-
-		go prod.SendMessage(topic, "", data)
-		prod.SendMessage("test", "", data)
+		// delivery is not awaited inside the request, the producer wait for it on shutdown
+		for _, t := range []string{topic, "test"} {
+			if err := prod.SendMessageAsync(t, "", data); err != nil {
+				c.Error(http.StatusServiceUnavailable, err)
+				return
+			}
+		}
 
-		c.JSON(http.StatusOK, data)
+		detailLog.AddOutputRequest("client", cmd, initInvoked, "", data)
+		c.JSON(http.StatusAccepted, middleware.NewResponse(http.StatusAccepted, data))
 	})
 
-	app.POST("/api/v1/auth/login", authHandler.Login)
-	app.POST("/api/v1/auth/register", authHandler.Register)
+	app.POST("/api/v1/auth/login", authHandler.Login, app.RateLimit(middleware.RateLimitConfig{
+		Name:   "auth-login",
+		Limit:  5,
+		Window: time.Minute,
+	}))
+	app.POST("/api/v1/auth/register", authHandler.Register, app.Idempotency(middleware.IdempotencyConfig{}))
 	app.POST("/api/v1/auth/verify", authHandler.Verify)
 
+	if authHandler.Verifier != nil {
+		app.GET("/api/v1/auth/me", func(c ms.HTTPContext) {
+			claims, _ := middleware.GetClaims(c.Context())
+			c.OK(claims)
+		}, middleware.JWT(authHandler.Verifier), app.NewCache(middleware.CacheConfig{
+			CacheControl: "private, no-cache",
+		}).Middleware())
+	}
+
 	app.Consume(servers, topic, "group_id", func(c *ms.ConsumerContext) {
 		// c.Log("Consumer:: -> " + c.ReadInput())
 		log.Println("Consumer:: -> ", c.Payload())
@@ -98,22 +158,57 @@ type VerifyRequest struct {
 }
 
 type AuthHandler struct {
-	BaseURL string
-	Name    string
-	System  string
+	BaseURL  string
+	Name     string
+	System   string
+	Verifier *middleware.JWTVerifier
+
+	login    *client.Client
+	register *client.Client
+	verify   *client.Client
+}
+
+// NewAuthHandler build the user-service clients once, they share the pooled connections
+func NewAuthHandler(baseURL string, name string, system string, balancer *client.Balancer) AuthHandler {
+	// fail fast while user-service is down instead of waiting for the timeout,
+	// every endpoint get its own breaker keyed by its path
+	breaker := &client.BreakerConfig{}
+	interceptors := client.WithInterceptors(client.PropagateHeaders("Accept-Language"), client.LoadBalance(balancer))
+
+	return AuthHandler{
+		BaseURL: baseURL,
+		Name:    name,
+		System:  system,
+		login: client.NewClient(client.ServiceConfig{
+			Name:    name,
+			Method:  http.MethodPost,
+			Url:     baseURL + "/api/v1/users/login",
+			System:  system,
+			Breaker: breaker,
+		}, interceptors),
+		register: client.NewClient(client.ServiceConfig{
+			Name:    name,
+			Method:  http.MethodPost,
+			Url:     baseURL + "/api/v1/users/register",
+			System:  system,
+			Breaker: breaker,
+		}, interceptors),
+		verify: client.NewClient(client.ServiceConfig{
+			Name:    name,
+			Method:  http.MethodPost,
+			Url:     baseURL + "/api/v1/users/verify",
+			System:  system,
+			Breaker: breaker,
+			// verify does not change state, it is safe to send again
+			Retry: &client.RetryPolicy{MaxAttempts: 3, AllowNonIdempotent: true},
+		}, interceptors),
+	}
 }
 
 func (h AuthHandler) Login(c ms.HTTPContext) {
 	result := c.L()
 	_ = result
 
-	httpClient := client.NewHttp(&client.ServiceConfig{
-		Name:   h.Name,
-		Method: http.MethodPost,
-		Url:    h.BaseURL + "/api/v1/users/login",
-		System: h.System,
-	})
-
 	var body LoginRequest
 	err := json.NewDecoder(c.Req.Body).Decode(&body)
 	if err != nil {
@@ -132,23 +227,25 @@ func (h AuthHandler) Login(c ms.HTTPContext) {
 	})
 
 	// r = r.WithContext(context.WithValue(r.Context(), constant.Session, session))
-	resp, err := httpClient.Call(c.Req.Context(), client.Option{
+	resp, err := h.login.Call(c.Req.Context(), client.Option{
 		Body: map[string]string{
 			"email":    body.Email,
 			"password": body.Password,
 		},
 		Header: map[string]string{
-			constants.ContentType:     constants.ContentTypeJSON,
-			string(constants.Session): c.GetSession(),
+			constants.ContentType: constants.ContentTypeJSON,
 		},
 	})
 	if err != nil {
-		c.Error(http.StatusInternalServerError, err)
+		clientError(c, err)
 		return
 	}
 
-	data := map[string]interface{}{}
-	json.Unmarshal(resp.Body, &data)
+	data, err := client.Decode[map[string]interface{}](resp)
+	if err != nil {
+		clientError(c, err)
+		return
+	}
 	c.AddLogClient(data)
 	c.JSON(resp.StatusCode, data)
 }
@@ -157,13 +254,6 @@ func (h AuthHandler) Register(c ms.HTTPContext) {
 	result := c.L()
 	_ = result
 
-	httpClient := client.NewHttp(&client.ServiceConfig{
-		Name:   h.Name,
-		Method: http.MethodPost,
-		Url:    h.BaseURL + "/api/v1/users/register",
-		System: h.System,
-	})
-
 	var body LoginRequest
 	err := json.NewDecoder(c.Req.Body).Decode(&body)
 	if err != nil {
@@ -181,21 +271,23 @@ func (h AuthHandler) Register(c ms.HTTPContext) {
 		"body":   body,
 	})
 
-	resp, err := httpClient.Call(c.Req.Context(), client.Option{
+	resp, err := h.register.Call(c.Req.Context(), client.Option{
 		Body: map[string]string{
 			"email":    body.Email,
 			"password": body.Password,
 		}, Header: map[string]string{
-			constants.ContentType:     constants.ContentTypeJSON,
-			string(constants.Session): c.GetSession()},
+			constants.ContentType: constants.ContentTypeJSON},
 	})
 	if err != nil {
-		c.Error(http.StatusInternalServerError, err)
+		clientError(c, err)
 		return
 	}
 
-	data := map[string]interface{}{}
-	json.Unmarshal(resp.Body, &data)
+	data, err := client.Decode[map[string]interface{}](resp)
+	if err != nil {
+		clientError(c, err)
+		return
+	}
 	c.AddLogClient(data)
 	c.JSON(resp.StatusCode, data)
 }
@@ -203,13 +295,6 @@ func (h AuthHandler) Register(c ms.HTTPContext) {
 func (h AuthHandler) Verify(c ms.HTTPContext) {
 	l := c.L()
 
-	httpClient := client.NewHttp(&client.ServiceConfig{
-		Name:   h.Name,
-		Method: http.MethodPost,
-		Url:    h.BaseURL + "/api/v1/users/verify",
-		System: h.System,
-	})
-
 	var body VerifyRequest
 	err := json.NewDecoder(c.Req.Body).Decode(&body)
 	if err != nil {
@@ -227,24 +312,58 @@ func (h AuthHandler) Verify(c ms.HTTPContext) {
 		"body":   body,
 	})
 
-	resp, err := httpClient.Call(c.Req.Context(), client.Option{
+	resp, err := h.verify.Call(c.Req.Context(), client.Option{
 		Body: map[string]string{
 			"access_token": body.AccessToken,
 		},
 		Header: map[string]string{
-			constants.ContentType:     constants.ContentTypeJSON,
-			string(constants.Session): c.GetSession(),
+			constants.ContentType: constants.ContentTypeJSON,
 		},
 	})
 
 	if err != nil {
-		c.Error(http.StatusInternalServerError, err)
+		clientError(c, err)
 		return
 	}
 
-	data := map[string]interface{}{}
-	json.Unmarshal(resp.Body, &data)
+	data, err := client.Decode[map[string]interface{}](resp)
+	if err != nil {
+		clientError(c, err)
+		return
+	}
 
 	l.AddEvent("client.output", data)
 	c.JSON(resp.StatusCode, data)
 }
+
+// clientError forward the status and result code of user-service, an open breaker is a 503,
+// a timeout a 504 and other transport errors are a 500
+func clientError(c ms.HTTPContext, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.Error(http.StatusGatewayTimeout, err)
+		return
+	}
+
+	var openErr *client.CircuitOpenError
+	if errors.As(err, &openErr) {
+		c.Res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(openErr.RetryAfter.Seconds()))))
+		c.Error(http.StatusServiceUnavailable, err)
+		return
+	}
+
+	var resErr *client.ResponseError
+	if !errors.As(err, &resErr) {
+		c.Error(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.AddLogClient(map[string]any{
+		"status": resErr.StatusCode,
+		"body":   string(resErr.Body),
+	})
+	if resErr.ResultCode == "" {
+		c.Error(resErr.StatusCode, err)
+		return
+	}
+	c.Fail(resErr.StatusCode, resErr.ResultCode, resErr.ResultDesc)
+}
@@ -0,0 +1,374 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheEntry struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	ETag     string      `json:"etag"`
+	Tags     []string    `json:"tags"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+type CacheStore interface {
+	// Get return nil without error on a miss
+	Get(ctx context.Context, key string) (*CacheEntry, error)
+	Set(ctx context.Context, key string, entry CacheEntry, ttl time.Duration) error
+	// InvalidateTags delete every entry with one of the tags
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+type CacheConfig struct {
+	// TTL enable server-side caching, 0 only compute ETags and answer If-None-Match
+	TTL time.Duration
+	// Store default is an in-memory LRU of 1000 entries
+	Store CacheStore
+	// KeyFunc default is method, path and sorted query
+	KeyFunc func(r *http.Request) string
+	// Vary are the request headers that select a different cached response
+	Vary []string
+	// TagFunc return the tags of a response, used to invalidate related entries together
+	TagFunc func(r *http.Request) []string
+	// CacheControl is sent on cacheable responses, e.g. "private, max-age=60"
+	CacheControl string
+}
+
+// Cache compute ETags, answer conditional GET requests with 304 and optionally
+// cache responses server-side. Entries are tagged with their key so Invalidate
+// remove every Vary variant. Requests with Authorization or Cookie are not stored
+// unless the header is listed in Vary.
+type Cache struct {
+	cfg CacheConfig
+}
+
+func NewCache(cfg CacheConfig) *Cache {
+	if cfg.TTL > 0 && cfg.Store == nil {
+		cfg.Store = NewLRUCacheStore(1000)
+	}
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = defaultCacheKey
+	}
+	for i, h := range cfg.Vary {
+		cfg.Vary[i] = http.CanonicalHeaderKey(h)
+	}
+	return &Cache{cfg: cfg}
+}
+
+func defaultCacheKey(r *http.Request) string {
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(r.URL.Path)
+	for i, k := range keys {
+		if i == 0 {
+			b.WriteString("?")
+		} else {
+			b.WriteString("&")
+		}
+		values := query[k]
+		sort.Strings(values)
+		b.WriteString(k + "=" + strings.Join(values, ","))
+	}
+	return b.String()
+}
+
+// Invalidate remove the entries of the keys built by KeyFunc
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) error {
+	tags := make([]string, len(keys))
+	for i, key := range keys {
+		tags[i] = "key:" + key
+	}
+	return c.InvalidateTags(ctx, tags...)
+}
+
+// InvalidateTags remove the entries of the tags returned by TagFunc
+func (c *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if c.cfg.Store == nil {
+		return nil
+	}
+	return c.cfg.Store.InvalidateTags(ctx, tags...)
+}
+
+func (c *Cache) variantKey(r *http.Request, key string) string {
+	var b strings.Builder
+	b.WriteString("cache:" + key)
+	for _, h := range c.cfg.Vary {
+		// values are hashed so credentials never end up in the store keys
+		sum := sha256.Sum256([]byte(r.Header.Get(h)))
+		b.WriteString("|" + h + "=" + hex.EncodeToString(sum[:8]))
+	}
+	return b.String()
+}
+
+func (c *Cache) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := c.cfg.KeyFunc(r)
+			variant := c.variantKey(r, key)
+			if len(c.cfg.Vary) > 0 {
+				w.Header().Set("Vary", strings.Join(c.cfg.Vary, ", "))
+			}
+
+			if c.cfg.TTL > 0 && !noCache(r) && c.shared(r) {
+				entry, err := c.cfg.Store.Get(r.Context(), variant)
+				if err != nil {
+					log.Println("cache store error:", err)
+				}
+				if entry != nil {
+					w.Header().Set("X-Cache", "HIT")
+					writeCached(w, r, entry)
+					return
+				}
+			}
+
+			// the response is held once, in the Logger capture buffer when there is one
+			before := w.Header().Clone()
+			rw, held := holdResponse(w)
+			defer func() {
+				// drop the held response so Recovery can write its 500 to the client
+				if p := recover(); p != nil {
+					held.discard()
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+
+			header := held.Header()
+			status := held.heldStatus()
+			if status != http.StatusOK {
+				held.release(status, true)
+				return
+			}
+
+			etag := header.Get("ETag")
+			if etag == "" {
+				etag = computeETag(held.heldBody())
+				header.Set("ETag", etag)
+			}
+			if c.cfg.CacheControl != "" && header.Get("Cache-Control") == "" {
+				header.Set("Cache-Control", c.cfg.CacheControl)
+			}
+
+			if c.cfg.TTL > 0 && cacheable(header) && c.shared(r) {
+				entry := CacheEntry{
+					Status:   status,
+					Header:   handlerHeader(before, header),
+					Body:     held.heldBody(),
+					ETag:     etag,
+					Tags:     []string{"key:" + key},
+					StoredAt: time.Now(),
+				}
+				if c.cfg.TagFunc != nil {
+					entry.Tags = append(entry.Tags, c.cfg.TagFunc(r)...)
+				}
+				if err := c.cfg.Store.Set(r.Context(), variant, entry, c.cfg.TTL); err != nil {
+					log.Println("cache store error:", err)
+				}
+				header.Set("X-Cache", "MISS")
+			}
+
+			if ETagMatch(r.Header.Get("If-None-Match"), etag) {
+				header.Del("Content-Type")
+				header.Del("Content-Length")
+				held.release(http.StatusNotModified, false)
+				return
+			}
+			held.release(status, r.Method != http.MethodHead)
+		})
+	}
+}
+
+// shared report whether the response can be stored for every caller,
+// requests with credentials are only cached when the credential header is part of Vary
+func (c *Cache) shared(r *http.Request) bool {
+	for _, h := range []string{"Authorization", "Cookie"} {
+		if r.Header.Get(h) != "" && !slices.Contains(c.cfg.Vary, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// handlerHeader return the headers set by the handler, the ones already set by
+// outer middlewares (e.g. CORS) depend on the request and must not be replayed
+func handlerHeader(before, after http.Header) http.Header {
+	header := http.Header{}
+	for k, v := range after {
+		if !slices.Equal(before[k], v) {
+			header[k] = slices.Clone(v)
+		}
+	}
+	return header
+}
+
+// writeCached write the entry, or 304 when If-None-Match match its ETag
+func writeCached(w http.ResponseWriter, r *http.Request, entry *CacheEntry) {
+	dst := w.Header()
+	for k, v := range entry.Header {
+		dst[k] = v
+	}
+
+	if ETagMatch(r.Header.Get("If-None-Match"), entry.ETag) {
+		dst.Del("Content-Type")
+		dst.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+}
+
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ETagMatch implement the weak comparison of If-None-Match
+func ETagMatch(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func noCache(r *http.Request) bool {
+	cc := r.Header.Get("Cache-Control")
+	return strings.Contains(cc, "no-cache") || strings.Contains(cc, "no-store")
+}
+
+func cacheable(header http.Header) bool {
+	cc := header.Get("Cache-Control")
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private") && header.Get("Set-Cookie") == ""
+}
+
+type lruItem struct {
+	key      string
+	entry    CacheEntry
+	expireAt time.Time
+}
+
+type lruCacheStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	tags     map[string]map[string]struct{}
+}
+
+// NewLRUCacheStore create an in-memory store that evict the least recently used entries
+func NewLRUCacheStore(capacity int) CacheStore {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	return &lruCacheStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    map[string]*list.Element{},
+		tags:     map[string]map[string]struct{}{},
+	}
+}
+
+func (s *lruCacheStore) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := el.Value.(*lruItem)
+	if time.Now().After(item.expireAt) {
+		s.remove(el)
+		return nil, nil
+	}
+	s.ll.MoveToFront(el)
+	entry := item.entry
+	return &entry, nil
+}
+
+func (s *lruCacheStore) Set(ctx context.Context, key string, entry CacheEntry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+
+	el := s.ll.PushFront(&lruItem{key: key, entry: entry, expireAt: time.Now().Add(ttl)})
+	s.items[key] = el
+	for _, tag := range entry.Tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = map[string]struct{}{}
+		}
+		s.tags[tag][key] = struct{}{}
+	}
+
+	for s.ll.Len() > s.capacity {
+		s.remove(s.ll.Back())
+	}
+	return nil
+}
+
+func (s *lruCacheStore) InvalidateTags(ctx context.Context, tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			if el, ok := s.items[key]; ok {
+				s.remove(el)
+			}
+		}
+		delete(s.tags, tag)
+	}
+	return nil
+}
+
+func (s *lruCacheStore) remove(el *list.Element) {
+	item := el.Value.(*lruItem)
+	s.ll.Remove(el)
+	delete(s.items, item.key)
+	for _, tag := range item.entry.Tags {
+		if keys, ok := s.tags[tag]; ok {
+			delete(keys, item.key)
+			if len(keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisCacheStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisCacheStore create a store shared by all instances, tags are kept in redis sets
+func NewRedisCacheStore(client redis.UniversalClient) CacheStore {
+	return &redisCacheStore{client: client}
+}
+
+func cacheTagKey(tag string) string {
+	return "cache-tag:" + tag
+}
+
+func (s *redisCacheStore) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	data, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *redisCacheStore) Set(ctx context.Context, key string, entry CacheEntry, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, key, data, ttl)
+	for _, tag := range entry.Tags {
+		pipe.SAdd(ctx, cacheTagKey(tag), key)
+		// the tag set outlive its entries a little, stale members are harmless
+		pipe.Expire(ctx, cacheTagKey(tag), 2*ttl)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *redisCacheStore) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		keys, err := s.client.SMembers(ctx, cacheTagKey(tag)).Result()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, cacheTagKey(tag))
+		if err := s.client.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
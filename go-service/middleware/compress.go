@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sing3demons/go-service/constants"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingBrotli  = "br"
+	EncodingZstd    = "zstd"
+)
+
+type CompressConfig struct {
+	// MinSize is the smallest body that is compressed, default 1024 bytes
+	MinSize int
+	// ContentTypes is the allowlist of content type prefixes, default json, xml, javascript and text/*
+	ContentTypes []string
+	// Encodings is the server preference when the client accept several with the same q, default br, zstd, gzip, deflate
+	Encodings []string
+}
+
+var defaultCompressContentTypes = []string{
+	constants.ContentTypeJSON,
+	constants.ContentTypeXML,
+	"application/javascript",
+	"text/",
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingGzip: {New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}},
+	EncodingDeflate: {New: func() any {
+		w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return w
+	}},
+	EncodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+	EncodingZstd: {New: func() any {
+		w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+}
+
+// Compress encode the response with the best encoding of Accept-Encoding.
+// It must wrap middleware.Logger so the summary log still record the uncompressed body.
+func Compress(cfg CompressConfig) func(http.Handler) http.Handler {
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = 1024
+	}
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = defaultCompressContentTypes
+	}
+	if len(cfg.Encodings) == 0 {
+		cfg.Encodings = []string{EncodingBrotli, EncodingZstd, EncodingGzip, EncodingDeflate}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), cfg.Encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, cfg: cfg, encoding: encoding, status: http.StatusOK}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding return the accepted encoding with the highest q, ties are broken by the server preference
+func negotiateEncoding(acceptEncoding string, preference []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	candidates := make([]string, 0, len(preference))
+	for _, enc := range preference {
+		q, ok := accepted[enc]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > 0 {
+			candidates = append(candidates, enc)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return qOf(accepted, candidates[i]) > qOf(accepted, candidates[j])
+	})
+	return candidates[0]
+}
+
+func qOf(accepted map[string]float64, enc string) float64 {
+	if q, ok := accepted[enc]; ok {
+		return q
+	}
+	return accepted["*"]
+}
+
+// compressWriter buffer the body until MinSize is reached, then decide whether to compress
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      CompressConfig
+	encoding string
+	status   int
+	buf      []byte
+	enc      encoder
+	decided  bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided {
+		return
+	}
+	cw.status = code
+	if code == http.StatusNoContent || code == http.StatusNotModified || code < http.StatusOK {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, data...)
+		if len(cw.buf) < cw.cfg.MinSize {
+			return len(data), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(data)
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+// Flush send what is buffered, streaming responses are compressed only when MinSize is already reached
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.cfg.MinSize)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.cfg.MinSize)
+	}
+	if cw.enc == nil {
+		return nil
+	}
+
+	err := cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	encoderPools[cw.encoding].Put(cw.enc)
+	cw.enc = nil
+	return err
+}
+
+func (cw *compressWriter) decide(largeEnough bool) error {
+	cw.decided = true
+
+	h := cw.Header()
+	if h.Get(constants.ContentType) == "" && len(cw.buf) > 0 {
+		h.Set(constants.ContentType, http.DetectContentType(cw.buf))
+	}
+
+	if largeEnough && cw.compressible(h) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// the representation changed, a strong validator no longer match
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+func (cw *compressWriter) compressible(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := h.Get(constants.ContentType)
+	if strings.HasPrefix(contentType, constants.ContentTypeEventStream) {
+		return false
+	}
+	for _, allowed := range cw.cfg.ContentTypes {
+		if strings.HasPrefix(contentType, allowed) {
+			return true
+		}
+	}
+	return false
+}
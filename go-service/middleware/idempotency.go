@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sing3demons/go-service/constants"
+)
+
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+type IdempotencyStore interface {
+	// Lock reserve the key for an in-flight request,
+	// when the key already exists it return false with the existing record
+	Lock(ctx context.Context, key string, fingerprint string, ttl time.Duration) (bool, *IdempotencyRecord, error)
+	// Save store the completed response
+	Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	// Unlock release the key so the request can be retried
+	Unlock(ctx context.Context, key string) error
+}
+
+type IdempotencyConfig struct {
+	// Store default is an in-memory store
+	Store IdempotencyStore
+	// TTL of a completed response, default 24h
+	TTL time.Duration
+	// LockTTL release an in-flight key if the instance die, default 1m
+	LockTTL time.Duration
+	// Required reject requests without Idempotency-Key with 400
+	Required bool
+	// KeyFunc scope the keys to the caller, default is KeyByCaller
+	KeyFunc KeyFunc
+}
+
+// KeyByCaller use the Authorization header when it is set, else the remote address
+func KeyByCaller(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return auth
+	}
+	return KeyByIP(r)
+}
+
+// Idempotency store the response of requests with an Idempotency-Key header and replay it for repeats.
+// A repeat while the first request is in flight get 409, a repeat with a different body get 422.
+// Server errors are not stored so the request can be retried.
+func Idempotency(cfg IdempotencyConfig) func(http.Handler) http.Handler {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryIdempotencyStore()
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.LockTTL <= 0 {
+		cfg.LockTTL = time.Minute
+	}
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = KeyByCaller
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get(constants.IdempotencyKey)
+			if idempotencyKey == "" {
+				if cfg.Required {
+					WriteError(w, http.StatusBadRequest, constants.IdempotencyKey+" header is required")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewBuffer(body))
+
+			sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+			fingerprint := hex.EncodeToString(sum[:])
+			// the caller is hashed so credentials never end up in the store
+			caller := sha256.Sum256([]byte(cfg.KeyFunc(r)))
+			key := "idempotency:" + routeName(r) + ":" + hex.EncodeToString(caller[:8]) + ":" + idempotencyKey
+
+			acquired, record, err := cfg.Store.Lock(r.Context(), key, fingerprint, cfg.LockTTL)
+			if err != nil {
+				// fail open, the store must not take the service down
+				log.Println("idempotency store error:", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !acquired {
+				switch {
+				case record == nil:
+					WriteError(w, http.StatusConflict, "a request with the same "+constants.IdempotencyKey+" is in progress")
+				case record.Fingerprint != fingerprint:
+					WriteError(w, http.StatusUnprocessableEntity, constants.IdempotencyKey+" is reused with a different request")
+				case !record.Completed:
+					WriteError(w, http.StatusConflict, "a request with the same "+constants.IdempotencyKey+" is in progress")
+				default:
+					replay(w, record)
+				}
+				return
+			}
+
+			bw := newBufferedWriter()
+			defer func() {
+				// release the key when the handler panic
+				if p := recover(); p != nil {
+					cfg.Store.Unlock(context.WithoutCancel(r.Context()), key)
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(bw, r)
+
+			ctx := context.WithoutCancel(r.Context())
+			if bw.status >= http.StatusInternalServerError {
+				cfg.Store.Unlock(ctx, key)
+			} else {
+				err := cfg.Store.Save(ctx, key, IdempotencyRecord{
+					Fingerprint: fingerprint,
+					Completed:   true,
+					Status:      bw.status,
+					Header:      bw.header.Clone(),
+					Body:        bw.body.Bytes(),
+				}, cfg.TTL)
+				if err != nil {
+					log.Println("idempotency store error:", err)
+				}
+			}
+			bw.flushTo(w)
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, record *IdempotencyRecord) {
+	dst := w.Header()
+	for k, v := range record.Header {
+		dst[k] = v
+	}
+	dst.Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+}
+
+type idempotencyEntry struct {
+	record   IdempotencyRecord
+	expireAt time.Time
+}
+
+type memoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]idempotencyEntry
+	lastSweep time.Time
+}
+
+// NewMemoryIdempotencyStore create a store local to the instance
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{entries: map[string]idempotencyEntry{}}
+}
+
+func (s *memoryIdempotencyStore) Lock(ctx context.Context, key string, fingerprint string, ttl time.Duration) (bool, *IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	if e, ok := s.entries[key]; ok && !now.After(e.expireAt) {
+		record := e.record
+		return false, &record, nil
+	}
+
+	s.entries[key] = idempotencyEntry{
+		record:   IdempotencyRecord{Fingerprint: fingerprint},
+		expireAt: now.Add(ttl),
+	}
+	return true, nil, nil
+}
+
+func (s *memoryIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = idempotencyEntry{record: record, expireAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Unlock(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep remove expired entries at most once per minute
+func (s *memoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.After(e.expireAt) {
+			delete(s.entries, key)
+		}
+	}
+}
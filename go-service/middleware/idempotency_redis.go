@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisIdempotencyStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisIdempotencyStore create a store shared by all instances
+func NewRedisIdempotencyStore(client redis.UniversalClient) IdempotencyStore {
+	return &redisIdempotencyStore{client: client}
+}
+
+func (s *redisIdempotencyStore) Lock(ctx context.Context, key string, fingerprint string, ttl time.Duration) (bool, *IdempotencyRecord, error) {
+	lock, err := json.Marshal(IdempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return false, nil, err
+	}
+
+	acquired, err := s.client.SetNX(ctx, key, lock, ttl).Result()
+	if err != nil || acquired {
+		return acquired, nil, err
+	}
+
+	data, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// the key expired between SETNX and GET, report it as in flight
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+
+	var record IdempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return false, nil, err
+	}
+	return false, &record, nil
+}
+
+func (s *redisIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, key, data, ttl).Err()
+}
+
+func (s *redisIdempotencyStore) Unlock(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
@@ -0,0 +1,477 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTokenMissing   = errors.New("token is missing")
+	ErrTokenMalformed = errors.New("token is malformed")
+	ErrTokenSignature = errors.New("token signature is invalid")
+	ErrTokenExpired   = errors.New("token is expired")
+	ErrTokenNotYet    = errors.New("token is not valid yet")
+	ErrTokenClaims    = errors.New("token claims are invalid")
+	ErrKeyNotFound    = errors.New("verification key not found")
+)
+
+type claimsKey struct{}
+
+// Claims of a verified token
+type Claims map[string]interface{}
+
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Scopes read the space separated "scope" claim or the "scp"/"scopes" list
+func (c Claims) Scopes() []string {
+	if scope, ok := c["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	for _, name := range []string{"scp", "scopes"} {
+		if scopes := stringList(c[name]); len(scopes) > 0 {
+			return scopes
+		}
+	}
+	return nil
+}
+
+// Roles read the "roles" list or the "role" claim
+func (c Claims) Roles() []string {
+	if roles := stringList(c["roles"]); len(roles) > 0 {
+		return roles
+	}
+	return stringList(c["role"])
+}
+
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	case []string:
+		return v
+	}
+	return nil
+}
+
+// GetClaims return the claims set by the JWT middleware
+func GetClaims(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+type JWTConfig struct {
+	// PublicKeyPEM is a PEM encoded public key or certificate
+	PublicKeyPEM []byte
+	// PublicKeyEnv is the name of an env var holding a base64 encoded PEM, e.g. PUBLIC_KEY
+	PublicKeyEnv string
+	// JWKSURL is fetched and cached, it is refreshed every JWKSRefresh and when a token has an unknown kid
+	JWKSURL     string
+	JWKSRefresh time.Duration
+	Issuer      string
+	Audience    string
+	// Leeway tolerate clock skew on exp and nbf
+	Leeway time.Duration
+	// HTTPClient is used to fetch the JWKS
+	HTTPClient *http.Client
+}
+
+type JWTVerifier struct {
+	cfg        JWTConfig
+	staticKeys []crypto.PublicKey
+
+	mu          sync.RWMutex
+	jwksKeys    map[string]crypto.PublicKey
+	jwksFetched time.Time
+	fetchMu     sync.Mutex
+}
+
+// NewJWTVerifier load the static keys, the JWKS is fetched on first use
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	if cfg.JWKSRefresh <= 0 {
+		cfg.JWKSRefresh = time.Hour
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	v := &JWTVerifier{cfg: cfg, jwksKeys: map[string]crypto.PublicKey{}}
+
+	if len(cfg.PublicKeyPEM) > 0 {
+		key, err := ParsePublicKeyPEM(cfg.PublicKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		v.staticKeys = append(v.staticKeys, key)
+	}
+
+	if cfg.PublicKeyEnv != "" {
+		encoded := os.Getenv(cfg.PublicKeyEnv)
+		if encoded == "" {
+			return nil, fmt.Errorf("env %s is empty", cfg.PublicKeyEnv)
+		}
+		pemBytes, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", cfg.PublicKeyEnv, err)
+		}
+		key, err := ParsePublicKeyPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		v.staticKeys = append(v.staticKeys, key)
+	}
+
+	if len(v.staticKeys) == 0 && cfg.JWKSURL == "" {
+		return nil, errors.New("jwt: no verification key configured")
+	}
+	return v, nil
+}
+
+// ParsePublicKeyPEM parse a PKIX, PKCS1 public key or a certificate
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt: invalid PEM")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify check the signature (RS256 or ES256) and the registered claims of a token
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	keys, err := v.keys(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	verified := false
+	for _, key := range keys {
+		if verifySignature(header.Alg, key, digest[:], signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrTokenSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) bool {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	// "none" and other algorithms are never accepted
+	return false
+}
+
+func (v *JWTVerifier) validateClaims(claims Claims) error {
+	now := time.Now()
+	if exp, ok := numericDate(claims["exp"]); ok && now.After(exp.Add(v.cfg.Leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return ErrTokenNotYet
+	}
+	if v.cfg.Issuer != "" && claims["iss"] != v.cfg.Issuer {
+		return ErrTokenClaims
+	}
+	if v.cfg.Audience != "" && !contains(stringList(claims["aud"]), v.cfg.Audience) {
+		return ErrTokenClaims
+	}
+	return nil
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// keys return the candidate keys of a token, the JWKS is refreshed when it is stale or the kid is unknown
+func (v *JWTVerifier) keys(ctx context.Context, kid string) ([]crypto.PublicKey, error) {
+	if v.cfg.JWKSURL == "" {
+		return v.staticKeys, nil
+	}
+
+	v.mu.RLock()
+	stale := time.Since(v.jwksFetched) > v.cfg.JWKSRefresh
+	key, found := v.jwksKeys[kid]
+	v.mu.RUnlock()
+
+	if stale || (kid != "" && !found) {
+		if err := v.refreshJWKS(ctx); err != nil && len(v.staticKeys) == 0 && !found {
+			return nil, err
+		}
+		v.mu.RLock()
+		key, found = v.jwksKeys[kid]
+		v.mu.RUnlock()
+	}
+
+	keys := append([]crypto.PublicKey{}, v.staticKeys...)
+	if found {
+		return append(keys, key), nil
+	}
+	if kid == "" {
+		// no kid, try every key of the set
+		v.mu.RLock()
+		for _, k := range v.jwksKeys {
+			keys = append(keys, k)
+		}
+		v.mu.RUnlock()
+	}
+	if len(keys) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// refreshJWKS fetch the key set, unknown kids can trigger a fetch at most every 30s
+func (v *JWTVerifier) refreshJWKS(ctx context.Context) error {
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+
+	v.mu.RLock()
+	recent := time.Since(v.jwksFetched) < 30*time.Second
+	v.mu.RUnlock()
+	if recent {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.JWKSURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	v.mu.Lock()
+	v.jwksKeys = keys
+	v.jwksFetched = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// JWT verify the bearer token of the Authorization header and put the claims into the request context
+func JWT(v *JWTVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				WriteError(w, http.StatusUnauthorized, ErrTokenMissing.Error())
+				return
+			}
+
+			claims, err := v.Verify(r.Context(), token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				WriteError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// RequireScopes reject with 403 when the claims miss one of the scopes, it must run after JWT
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return requireClaims("scope", Claims.Scopes, scopes, true)
+}
+
+// RequireRoles reject with 403 when the claims have none of the roles, it must run after JWT
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return requireClaims("role", Claims.Roles, roles, false)
+}
+
+// requireClaims check all the required values are granted, or at least one when all is false
+func requireClaims(name string, get func(Claims) []string, required []string, all bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaims(r.Context())
+			if !ok {
+				WriteError(w, http.StatusUnauthorized, ErrTokenMissing.Error())
+				return
+			}
+
+			granted := get(claims)
+			matched := 0
+			for _, want := range required {
+				if contains(granted, want) {
+					matched++
+				}
+			}
+
+			if (all && matched < len(required)) || (!all && len(required) > 0 && matched == 0) {
+				WriteError(w, http.StatusForbidden, fmt.Sprintf("insufficient %s", name))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
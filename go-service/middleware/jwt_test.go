@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestVerifier(t *testing.T, cfg JWTConfig) (*JWTVerifier, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.PublicKeyPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	v, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, key
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signToken build a token with alg, sign produce the signature of the signing input
+func signToken(t *testing.T, alg string, claims Claims, sign func(input []byte) []byte) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]string{"alg": alg, "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(input)))
+}
+
+func TestJWTVerifierVerify(t *testing.T) {
+	v, key := newTestVerifier(t, JWTConfig{Issuer: "user-service", Leeway: 10 * time.Second})
+
+	rs256 := func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	// the public key used as an HMAC secret is the classic algorithm confusion attack
+	hs256 := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, v.cfg.PublicKeyPEM)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	none := func(input []byte) []byte { return nil }
+
+	now := time.Now()
+	valid := Claims{"sub": "u1", "iss": "user-service", "exp": float64(now.Add(time.Hour).Unix())}
+	with := func(k string, val interface{}) Claims {
+		c := Claims{}
+		for key, v := range valid {
+			c[key] = v
+		}
+		c[k] = val
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid RS256", signToken(t, "RS256", valid, rs256), nil},
+		{"alg none", signToken(t, "none", valid, none), ErrTokenSignature},
+		{"alg none with RS256 signature", signToken(t, "none", valid, rs256), ErrTokenSignature},
+		{"HS256 signed with the public key", signToken(t, "HS256", valid, hs256), ErrTokenSignature},
+		{"RS256 header with HMAC signature", signToken(t, "RS256", valid, hs256), ErrTokenSignature},
+		{"expired", signToken(t, "RS256", with("exp", float64(now.Add(-time.Minute).Unix())), rs256), ErrTokenExpired},
+		{"expired within leeway", signToken(t, "RS256", with("exp", float64(now.Add(-2*time.Second).Unix())), rs256), nil},
+		{"not valid yet", signToken(t, "RS256", with("nbf", float64(now.Add(time.Minute).Unix())), rs256), ErrTokenNotYet},
+		{"wrong issuer", signToken(t, "RS256", with("iss", "other"), rs256), ErrTokenClaims},
+		{"malformed", "a.b", ErrTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && claims.Subject() != "u1" {
+				t.Fatalf("Verify() subject = %q, want u1", claims.Subject())
+			}
+		})
+	}
+}
+
+func TestJWTVerifierTamperedPayload(t *testing.T) {
+	v, key := newTestVerifier(t, JWTConfig{})
+
+	token := signToken(t, "RS256", Claims{"sub": "u1"}, func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return sig
+	})
+	parts := strings.Split(token, ".")
+	forged := parts[0] + "." + encodeSegment(t, Claims{"sub": "admin"}) + "." + parts[2]
+
+	if _, err := v.Verify(context.Background(), forged); !errors.Is(err, ErrTokenSignature) {
+		t.Fatalf("Verify() error = %v, want %v", err, ErrTokenSignature)
+	}
+}
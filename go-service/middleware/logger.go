@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,10 +23,16 @@ type HandlerResponse struct {
 	Data             interface{} `json:"data,omitempty"`
 }
 
+// maxCaptureSize is the largest response body kept for the summary log
+const maxCaptureSize = 64 << 10
+
 type customResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	body       *bytes.Buffer
+	size       int
+	truncated  bool
+	holding    bool
 }
 
 // newCustomResponseWriter initializes a new instance of CustomResponseWriter
@@ -40,21 +47,107 @@ func newCustomResponseWriter(w http.ResponseWriter) *customResponseWriter {
 // WriteHeader captures the status code
 func (crw *customResponseWriter) WriteHeader(code int) {
 	crw.statusCode = code
+	if crw.holding {
+		return
+	}
 	crw.ResponseWriter.WriteHeader(code)
 }
 
-// Write captures the response body
+// Write captures the response body, only json and text bodies up to maxCaptureSize are kept
 func (crw *customResponseWriter) Write(data []byte) (int, error) {
-	crw.body.Write(data) // Capture the response body
+	crw.size += len(data)
+	if crw.holding {
+		return crw.body.Write(data)
+	}
+	if capturable(crw.Header().Get(constants.ContentType)) {
+		if room := maxCaptureSize - crw.body.Len(); room >= len(data) {
+			crw.body.Write(data)
+		} else {
+			crw.body.Write(data[:max(room, 0)])
+			crw.truncated = true
+		}
+	}
 	return crw.ResponseWriter.Write(data)
 }
 
+// capturable report whether a body of contentType is worth keeping for the summary log,
+// streamed and binary bodies are only counted
+func capturable(contentType string) bool {
+	switch {
+	case contentType == "", strings.HasPrefix(contentType, constants.ContentTypeEventStream):
+		return false
+	case strings.HasPrefix(contentType, constants.ContentTypeJSON),
+		strings.HasPrefix(contentType, constants.ContentTypeXML),
+		strings.HasPrefix(contentType, "text/"):
+		return true
+	}
+	return false
+}
+
+// hold keep the whole response in the capture buffer instead of sending it,
+// it let Cache use the captured body without buffering the response a second time
+func (crw *customResponseWriter) hold() {
+	crw.holding = true
+	crw.statusCode = http.StatusOK
+	crw.size = 0
+	crw.truncated = false
+	crw.body.Reset()
+}
+
+func (crw *customResponseWriter) heldStatus() int {
+	return crw.statusCode
+}
+
+func (crw *customResponseWriter) heldBody() []byte {
+	return crw.body.Bytes()
+}
+
+// release send the held response with status, the body is only sent when writeBody is true
+func (crw *customResponseWriter) release(status int, writeBody bool) {
+	crw.holding = false
+	crw.statusCode = status
+	crw.ResponseWriter.WriteHeader(status)
+
+	body := crw.body.Bytes()
+	if writeBody {
+		crw.ResponseWriter.Write(body)
+	} else {
+		body, crw.size = nil, 0
+	}
+
+	// the held bytes may be kept by the caller, so the log capture get its own capped slice
+	if n := len(body); n > maxCaptureSize {
+		body = body[:maxCaptureSize:maxCaptureSize]
+		crw.truncated = true
+	} else {
+		body = body[:n:n]
+	}
+	crw.body = bytes.NewBuffer(body)
+}
+
+// discard drop the held response and stop holding
+func (crw *customResponseWriter) discard() {
+	crw.holding = false
+	crw.statusCode = http.StatusOK
+	crw.size = 0
+	crw.body.Reset()
+}
+
+// Flush sends any buffered data to the client, it is required for streaming responses
+func (crw *customResponseWriter) Flush() {
+	if crw.holding {
+		return
+	}
+	if f, ok := crw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var ctx context.Context = r.Context()
-		var invokeId string
-
-		if r.Header.Get(string(constants.Session)) == "" {
+		// adopt the ids of the caller so the logs of both services can be joined
+		invokeId := r.Header.Get(string(constants.Session))
+		if invokeId == "" {
 			uuidV7, err := uuid.NewV7()
 			if err != nil {
 				invokeId = uuid.New().String()
@@ -62,19 +155,39 @@ func Logger(next http.Handler) http.Handler {
 				invokeId = uuidV7.String()
 			}
 		}
-		r = r.WithContext(context.WithValue(r.Context(), constants.Session, invokeId))
 
 		hostName, _ := os.Hostname()
 
-		traceID := uuid.New().String()
-		spanID := uuid.New().String()
+		traceID, parentSpanID, ok := logger.ParseTraceparent(r.Header.Get(constants.TraceParent))
+		if !ok {
+			traceID = r.Header.Get(constants.TraceIDHeader)
+			parentSpanID = r.Header.Get(constants.ParentSpanIDHeader)
+		}
+		if traceID == "" {
+			traceID = logger.NewTraceID()
+		}
+		spanID := logger.NewSpanID()
 
-		// Add trace_id and span_id to the request context
-		ctx = context.WithValue(r.Context(), constants.TraceIDKey, traceID)
+		// Add session, trace_id and span_id to the request context
+		ctx := context.WithValue(r.Context(), constants.Session, invokeId)
+		ctx = context.WithValue(ctx, constants.TraceIDKey, traceID)
 		ctx = context.WithValue(ctx, constants.SpanIDKey, spanID)
+		if parentSpanID != "" {
+			ctx = context.WithValue(ctx, constants.ParentSpanIDKey, parentSpanID)
+		}
+		// the incoming headers are forwarded by client.PropagateHeaders, credentials are left out
+		headers := r.Header.Clone()
+		for _, name := range constants.CredentialHeaders {
+			headers.Del(name)
+		}
+		ctx = context.WithValue(ctx, constants.HeadersKey, headers)
 
 		// Store request body
-		bodyBytes, _ := io.ReadAll(r.Body)
+		bodyBytes, err := io.ReadAll(r.Body)
+		if err != nil && isBodyTooLarge(err) {
+			WriteError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
 
 		r.Body.Close() //  must close
 		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
@@ -88,12 +201,15 @@ func Logger(next http.Handler) http.Handler {
 		resultReqBytes, _ := Minify(bodyBytes)
 
 		summaryLog := logger.Summary{
-			Hostname: hostName,
-			Appname:  "go-api",
-			Ssid:     r.RequestURI,
-			Intime:   startTime.Format(time.RFC3339),
-			Invoke:   invokeId,
-			Input:    string(resultReqBytes),
+			Hostname:   hostName,
+			Appname:    "go-api",
+			Ssid:       r.RequestURI,
+			Intime:     startTime.Format(time.RFC3339),
+			Invoke:     invokeId,
+			Input:      string(resultReqBytes),
+			TraceID:    traceID,
+			SpanID:     spanID,
+			ParentSpan: parentSpanID,
 		}
 
 		ctx = logger.SetInvoke(ctx, invokeId)
@@ -108,13 +224,13 @@ func Logger(next http.Handler) http.Handler {
 		var res HandlerResponse
 		resBytes := crw.body.Bytes()
 		json.Unmarshal(resBytes, &res)
-		resultResBytes, _ := Minify(resBytes)
-		summaryLog.Output = string(resultResBytes)
+		summaryLog.Output = summaryOutput(crw.Header().Get(constants.ContentType), resBytes, crw.size, crw.truncated)
 		endTime := time.Now()
 		summaryLog.Outtime = endTime.Format(time.RFC3339)
 		duration := endTime.Sub(startTime)
 		summaryLog.DiffTime = duration.Milliseconds()
 		summaryLog.Status = crw.statusCode
+		summaryLog.ResultCode = res.ResultCode
 
 		go logger.ToSummaryLog(summaryLog)
 
@@ -123,6 +239,23 @@ func Logger(next http.Handler) http.Handler {
 	})
 }
 
+// summaryOutput return the response body for the summary log, binary and streamed bodies are replaced by their size
+func summaryOutput(contentType string, body []byte, size int, truncated bool) string {
+	switch {
+	case size == 0:
+		return ""
+	case truncated:
+		return fmt.Sprintf("%s...<%d bytes %s>", body, size, contentType)
+	case strings.HasPrefix(contentType, constants.ContentTypeJSON):
+		resultResBytes, _ := Minify(body)
+		return string(resultResBytes)
+	case strings.HasPrefix(contentType, "text/"), strings.HasPrefix(contentType, constants.ContentTypeXML):
+		return string(body)
+	default:
+		return fmt.Sprintf("<%d bytes %s>", size, contentType)
+	}
+}
+
 func Minify(jsonB []byte) ([]byte, error) {
 	var buff *bytes.Buffer = new(bytes.Buffer)
 	errCompact := json.Compact(buff, jsonB)
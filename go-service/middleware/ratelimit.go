@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sing3demons/go-service/constants"
+)
+
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allow bursts up to Limit and refill Limit tokens per Window
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allow Limit requests in any Window
+	SlidingWindow
+)
+
+// KeyFunc return the identity a request is limited by
+type KeyFunc func(r *http.Request) string
+
+type RateLimitConfig struct {
+	// Name scope the keys of the policy, default is the route path
+	Name      string
+	Limit     int
+	Window    time.Duration
+	Algorithm RateLimitAlgorithm
+	// KeyFunc default is KeyByIP, or KeyByForwardedIP when TrustedProxies is set
+	KeyFunc KeyFunc
+	// TrustedProxies are the proxy ips or cidrs allowed to report the client address
+	TrustedProxies []string
+	// Store default is an in-memory store
+	Store RateLimitStore
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, algorithm RateLimitAlgorithm, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// KeyByIP use the remote address of the connection, forwarding headers are ignored
+// since any client can set them, use KeyByForwardedIP behind a proxy
+func KeyByIP(r *http.Request) string {
+	return remoteIP(r)
+}
+
+// KeyByForwardedIP use the client address reported by X-Forwarded-For or X-Real-Ip,
+// the headers are only read when the request come from one of trustedProxies (ips or cidrs).
+// X-Forwarded-For is walked from the right and the first untrusted address is used.
+func KeyByForwardedIP(trustedProxies ...string) KeyFunc {
+	trusted := parseTrustedProxies(trustedProxies)
+	isTrusted := func(ip string) bool {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return false
+		}
+		for _, n := range trusted {
+			if n.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(r *http.Request) string {
+		ip := remoteIP(r)
+		if !isTrusted(ip) {
+			return ip
+		}
+
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(strings.Join(forwarded, ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if hop == "" {
+					continue
+				}
+				ip = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+			return ip
+		}
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); realIP != "" {
+			return realIP
+		}
+		return ip
+	}
+}
+
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil {
+				bits := 8 * len(ip.To4())
+				if bits == 0 {
+					bits = 128
+				}
+				p = fmt.Sprintf("%s/%d", p, bits)
+			}
+		}
+		if _, n, err := net.ParseCIDR(p); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+// remoteIP return the host part of the connection address
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader use the value of a header, e.g. an api key
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyBySession use the session set by Logger
+func KeyBySession(r *http.Request) string {
+	session, _ := r.Context().Value(constants.Session).(string)
+	return session
+}
+
+// RateLimit reject requests over the limit with 429 and set the RateLimit-* headers
+func RateLimit(cfg RateLimitConfig) func(http.Handler) http.Handler {
+	if cfg.Limit <= 0 {
+		cfg.Limit = 60
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.KeyFunc == nil {
+		cfg.KeyFunc = KeyByIP
+		if len(cfg.TrustedProxies) > 0 {
+			cfg.KeyFunc = KeyByForwardedIP(cfg.TrustedProxies...)
+		}
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryRateLimitStore()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := cfg.Name
+			if name == "" {
+				name = routeName(r)
+			}
+			key := fmt.Sprintf("ratelimit:%s:%s", name, cfg.KeyFunc(r))
+
+			result, err := cfg.Store.Allow(r.Context(), key, cfg.Algorithm, cfg.Limit, cfg.Window)
+			if err != nil {
+				// fail open, the store must not take the service down
+				log.Println("rate limit store error:", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				WriteError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// routeName return the path template of the matched route or the request path
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.URL.Path
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+type rateLimitEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	windowStart time.Time
+	prevCount   int
+	currCount   int
+
+	expireAt time.Time
+}
+
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRateLimitStore create a store local to the instance
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{
+		entries: make(map[string]*rateLimitEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *memoryRateLimitStore) Allow(ctx context.Context, key string, algorithm RateLimitAlgorithm, limit int, window time.Duration) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &rateLimitEntry{tokens: float64(limit), last: now, windowStart: now}
+		s.entries[key] = e
+	}
+	e.expireAt = now.Add(2 * window)
+
+	if algorithm == SlidingWindow {
+		return e.slidingWindow(now, limit, window), nil
+	}
+	return e.tokenBucket(now, limit, window), nil
+}
+
+// sweep remove expired entries at most once per minute
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.After(e.expireAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (e *rateLimitEntry) tokenBucket(now time.Time, limit int, window time.Duration) RateLimitResult {
+	rate := float64(limit) / window.Seconds() // tokens per second
+	e.tokens = math.Min(float64(limit), e.tokens+now.Sub(e.last).Seconds()*rate)
+	e.last = now
+
+	result := RateLimitResult{Limit: limit}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - e.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = time.Duration((float64(limit) - e.tokens) / rate * float64(time.Second))
+	return result
+}
+
+// slidingWindow approximate the count of the last window from the current and previous fixed windows
+func (e *rateLimitEntry) slidingWindow(now time.Time, limit int, window time.Duration) RateLimitResult {
+	elapsed := now.Sub(e.windowStart)
+	if elapsed >= 2*window {
+		e.prevCount, e.currCount = 0, 0
+		e.windowStart = now.Truncate(window)
+	} else if elapsed >= window {
+		e.prevCount, e.currCount = e.currCount, 0
+		e.windowStart = e.windowStart.Add(window)
+	}
+
+	weight := 1 - float64(now.Sub(e.windowStart))/float64(window)
+	count := float64(e.prevCount)*weight + float64(e.currCount)
+
+	result := RateLimitResult{Limit: limit, Reset: e.windowStart.Add(window).Sub(now)}
+	if count+1 <= float64(limit) {
+		e.currCount++
+		count++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = result.Reset
+	}
+	result.Remaining = int(math.Max(0, float64(limit)-count))
+	return result
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local now_ms = tonumber(ARGV[3])
+local rate = limit / window_ms
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(data[1]) or limit
+local last = tonumber(data[2]) or now_ms
+tokens = math.min(limit, tokens + math.max(0, now_ms - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now_ms)
+redis.call('PEXPIRE', KEYS[1], window_ms * 2)
+return {allowed, tostring(tokens)}
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local now_ms = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now_ms - window_ms)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now_ms, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window_ms)
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {allowed, count, oldest[2] or tostring(now_ms)}
+`)
+
+type redisRateLimitStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisRateLimitStore create a store shared by all instances
+func NewRedisRateLimitStore(client redis.UniversalClient) RateLimitStore {
+	return &redisRateLimitStore{client: client}
+}
+
+func (s *redisRateLimitStore) Allow(ctx context.Context, key string, algorithm RateLimitAlgorithm, limit int, window time.Duration) (RateLimitResult, error) {
+	now := time.Now()
+	nowMs := now.UnixMilli()
+	windowMs := window.Milliseconds()
+
+	if algorithm == SlidingWindow {
+		res, err := slidingWindowScript.Run(ctx, s.client, []string{key}, limit, windowMs, nowMs, uuid.New().String()).Slice()
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		if len(res) != 3 {
+			return RateLimitResult{}, fmt.Errorf("unexpected sliding window result %v", res)
+		}
+
+		count, _ := res[1].(int64)
+		oldest, _ := strconv.ParseFloat(fmt.Sprint(res[2]), 64)
+		reset := time.Duration(int64(oldest)+windowMs-nowMs) * time.Millisecond
+
+		result := RateLimitResult{
+			Allowed:   res[0] == int64(1),
+			Limit:     limit,
+			Remaining: int(math.Max(0, float64(int64(limit)-count))),
+			Reset:     reset,
+		}
+		if !result.Allowed {
+			result.RetryAfter = reset
+		}
+		return result, nil
+	}
+
+	res, err := tokenBucketScript.Run(ctx, s.client, []string{key}, limit, windowMs, nowMs).Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(res) != 2 {
+		return RateLimitResult{}, fmt.Errorf("unexpected token bucket result %v", res)
+	}
+
+	tokens, _ := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+	rate := float64(limit) / float64(windowMs) // tokens per millisecond
+	result := RateLimitResult{
+		Allowed:   res[0] == int64(1),
+		Limit:     limit,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(limit)-tokens)/rate) * time.Millisecond,
+	}
+	if !result.Allowed {
+		result.RetryAfter = time.Duration((1-tokens)/rate) * time.Millisecond
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sing3demons/go-service/mlog"
+)
+
+// PanicTotal count the recovered panics by transport (http, consumer)
+var PanicTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "panic_recovered_total",
+		Help: "Number of panics recovered in handlers.",
+	},
+	[]string{"transport"},
+)
+
+// Recovery turn a panic in the next handlers into a 500 envelope, it must run after Logger
+// so the session and trace ids are available and the summary log record the 500
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// the handler abort the response on purpose
+				panic(v)
+			}
+
+			LogPanic(r.Context(), "http", r.Method+" "+r.URL.Path, v, debug.Stack())
+			WriteError(w, http.StatusInternalServerError, "internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LogPanic write the detail log of a recovered panic and count it
+func LogPanic(ctx context.Context, transport string, name string, v interface{}, stack []byte) {
+	PanicTotal.WithLabelValues(transport).Inc()
+
+	detail := mlog.NewContextDetailLog(ctx, map[string]interface{}{
+		"transport": transport,
+		"name":      name,
+	})
+	detail.AddEvent("panic", map[string]interface{}{
+		"error": fmt.Sprint(v),
+		"stack": string(stack),
+	})
+	detail.End()
+
+	log.Printf("panic recovered session=%s trace_id=%s: %v\n%s", detail.Session, detail.Context.TraceID, v, stack)
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/sing3demons/go-service/constants"
+)
+
+type ResultCode struct {
+	Code string
+	Desc string
+}
+
+type Pagination struct {
+	Page       int `json:"page"`
+	PageSize   int `json:"pageSize"`
+	Total      int `json:"total"`
+	TotalPages int `json:"totalPages"`
+}
+
+type ListData struct {
+	Items      interface{} `json:"items"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+var (
+	resultCodesMu sync.RWMutex
+	resultCodes   = map[int]ResultCode{
+		http.StatusOK:                    {Code: "20000", Desc: "success"},
+		http.StatusCreated:               {Code: "20100", Desc: "created"},
+		http.StatusAccepted:              {Code: "20200", Desc: "accepted"},
+		http.StatusBadRequest:            {Code: "40000", Desc: "bad request"},
+		http.StatusUnauthorized:          {Code: "40100", Desc: "unauthorized"},
+		http.StatusForbidden:             {Code: "40300", Desc: "forbidden"},
+		http.StatusNotFound:              {Code: "40400", Desc: "data not found"},
+		http.StatusConflict:              {Code: "40900", Desc: "conflict"},
+		http.StatusRequestEntityTooLarge: {Code: "41300", Desc: "request entity too large"},
+		http.StatusUnprocessableEntity:   {Code: "42200", Desc: "unprocessable entity"},
+		http.StatusTooManyRequests:       {Code: "42900", Desc: "too many requests"},
+		http.StatusInternalServerError:   {Code: "50000", Desc: "system error"},
+		http.StatusBadGateway:            {Code: "50200", Desc: "bad gateway"},
+		http.StatusServiceUnavailable:    {Code: "50300", Desc: "service unavailable"},
+		http.StatusGatewayTimeout:        {Code: "50400", Desc: "gateway timeout"},
+	}
+)
+
+// SetResultCodes add or override entries of the result code catalogue, keyed by http status
+func SetResultCodes(codes map[int]ResultCode) {
+	resultCodesMu.Lock()
+	defer resultCodesMu.Unlock()
+	for status, code := range codes {
+		resultCodes[status] = code
+	}
+}
+
+// GetResultCode return the result code of http status, unknown status fallback to "<status>00"
+func GetResultCode(status int) ResultCode {
+	resultCodesMu.RLock()
+	code, ok := resultCodes[status]
+	resultCodesMu.RUnlock()
+	if ok {
+		return code
+	}
+	return ResultCode{Code: fmt.Sprintf("%d00", status), Desc: http.StatusText(status)}
+}
+
+// NewResponse build the standard envelope from the catalogue
+func NewResponse(status int, data interface{}) HandlerResponse {
+	code := GetResultCode(status)
+	return HandlerResponse{
+		ResultCode: code.Code,
+		ResultDesc: code.Desc,
+		Data:       data,
+	}
+}
+
+// WriteResponse write the standard envelope as json
+func WriteResponse(w http.ResponseWriter, status int, res HandlerResponse) {
+	w.Header().Set(constants.ContentType, constants.ContentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// WriteError write the standard envelope of http status with developer message
+func WriteError(w http.ResponseWriter, status int, developerMessage string) {
+	res := NewResponse(status, nil)
+	res.DeveloperMessage = developerMessage
+	WriteResponse(w, status, res)
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/sing3demons/go-service/constants"
+)
+
+type timeoutKey struct{}
+
+// timeoutState let an inner Timeout replace the deadline of an outer one,
+// parent is the request context before the outer deadline was applied
+type timeoutState struct {
+	parent     context.Context
+	overridden atomic.Bool
+}
+
+type timeoutWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.wroteHeader = true
+	return tw.ResponseWriter.Write(data)
+}
+
+// Flush sends any buffered data to the client, it is required for streaming responses
+func (tw *timeoutWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap return the underlying writer for http.ResponseController
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// Timeout set a deadline on the request context, handlers are expected to stop when the context is done.
+// A 504 is written when the deadline passed and the handler returned without writing anything,
+// a response already started (e.g. a stream) is left as is.
+// A shorter X-Request-Timeout header (milliseconds) from the caller is honored.
+// A Timeout set on a route replace the one set on the router, it can shorten or extend it,
+// and Timeout(0) remove the deadline, e.g. for SSE routes.
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parent := r.Context()
+			if outer, ok := parent.Value(timeoutKey{}).(*timeoutState); ok {
+				outer.overridden.Store(true)
+				// keep the values of the request but not the outer deadline
+				detached, cancel := context.WithCancel(context.WithoutCancel(parent))
+				defer cancel()
+				stop := context.AfterFunc(outer.parent, cancel)
+				defer stop()
+				parent = detached
+			}
+
+			d := timeout
+			if ms, err := strconv.ParseInt(r.Header.Get(constants.RequestTimeout), 10, 64); err == nil && ms > 0 {
+				if inbound := time.Duration(ms) * time.Millisecond; d <= 0 || inbound < d {
+					d = inbound
+				}
+			}
+
+			state := &timeoutState{parent: parent}
+			ctx := context.WithValue(parent, timeoutKey{}, state)
+			if d > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, d)
+				defer cancel()
+			}
+
+			tw := &timeoutWriter{ResponseWriter: w}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+
+			if tw.wroteHeader || state.overridden.Load() {
+				return
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				WriteError(w, http.StatusGatewayTimeout, fmt.Sprintf("request timeout after %s", d))
+			}
+		})
+	}
+}
+
+// NoTimeout remove the deadline set by the router Timeout, it is the same as Timeout(0)
+func NoTimeout(next http.Handler) http.Handler {
+	return Timeout(0)(next)
+}
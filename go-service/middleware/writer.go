@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// bufferedWriter hold the whole response until it is copied to the real writer,
+// it is used by the middlewares that decide on the response after the handler returned
+type bufferedWriter struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func newBufferedWriter() *bufferedWriter {
+	return &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+}
+
+func (b *bufferedWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedWriter) WriteHeader(code int) {
+	if b.wroteHeader {
+		return
+	}
+	b.wroteHeader = true
+	b.status = code
+}
+
+func (b *bufferedWriter) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(data)
+}
+
+// flushTo copy the buffered headers, status and body to w
+func (b *bufferedWriter) flushTo(w http.ResponseWriter) {
+	dst := w.Header()
+	for k, v := range b.header {
+		dst[k] = v
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
+
+// responseHolder keep a response until the middleware that held it decide how to send it
+type responseHolder interface {
+	Header() http.Header
+	heldStatus() int
+	heldBody() []byte
+	// release send the response with status, the body only when writeBody is true
+	release(status int, writeBody bool)
+	// discard drop the response, the next writes go to the client
+	discard()
+}
+
+// holdResponse return the writer the handler must use and the holder of its response.
+// When Logger is in the chain its capture buffer is reused, otherwise the response is buffered here.
+func holdResponse(w http.ResponseWriter) (http.ResponseWriter, responseHolder) {
+	for inner := w; inner != nil; {
+		if crw, ok := inner.(*customResponseWriter); ok {
+			crw.hold()
+			return w, crw
+		}
+		u, ok := inner.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		inner = u.Unwrap()
+	}
+
+	bw := newBufferedWriter()
+	return bw, &bufferedHolder{bufferedWriter: bw, w: w}
+}
+
+type bufferedHolder struct {
+	*bufferedWriter
+	w http.ResponseWriter
+}
+
+func (h *bufferedHolder) heldStatus() int {
+	return h.status
+}
+
+func (h *bufferedHolder) heldBody() []byte {
+	return h.body.Bytes()
+}
+
+func (h *bufferedHolder) release(status int, writeBody bool) {
+	h.status = status
+	if !writeBody {
+		h.body.Reset()
+	}
+	h.flushTo(h.w)
+}
+
+func (h *bufferedHolder) discard() {}
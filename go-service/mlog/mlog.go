@@ -10,7 +10,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/sing3demons/go-service/constants"
 	"github.com/sing3demons/go-service/logger"
 )
@@ -48,18 +47,27 @@ type LogEvent struct {
 }
 
 func NewDetailLog(req *http.Request) *DetailLog {
-	traceID := req.Context().Value(constants.TraceIDKey).(string)
+	return NewContextDetailLog(req.Context(), map[string]interface{}{
+		"http.route":  req.URL.Path,
+		"http.method": req.Method,
+		"http.device": req.UserAgent(),
+	})
+}
+
+// NewContextDetailLog create a detail log from the session, trace and span ids of ctx,
+// missing ids are generated
+func NewContextDetailLog(ctx context.Context, attributes map[string]interface{}) *DetailLog {
+	traceID, _ := ctx.Value(constants.TraceIDKey).(string)
 	if traceID == "" {
-		traceID = uuid.New().String()
-		req = req.WithContext(context.WithValue(req.Context(), constants.TraceIDKey, traceID))
+		traceID = logger.NewTraceID()
 	}
 
-	spanID := req.Context().Value(constants.SpanIDKey).(string)
+	spanID, _ := ctx.Value(constants.SpanIDKey).(string)
 	if spanID == "" {
-		spanID = uuid.New().String()
-		req = req.WithContext(context.WithValue(req.Context(), constants.SpanIDKey, spanID))
+		spanID = logger.NewSpanID()
 	}
 
+	session, _ := ctx.Value(constants.Session).(string)
 	startTime := time.Now().Format(time.RFC3339)
 
 	return &DetailLog{
@@ -69,14 +77,10 @@ func NewDetailLog(req *http.Request) *DetailLog {
 			TraceID: traceID,
 			SpanID:  spanID,
 		},
-		Session:   req.Context().Value(constants.Session).(string),
-		StartTime: startTime,
-		Attributes: map[string]interface{}{
-			"http.route":  req.URL.Path,
-			"http.method": req.Method,
-			"http.device": req.UserAgent(),
-		},
-		Events: []LogEvent{},
+		Session:    session,
+		StartTime:  startTime,
+		Attributes: attributes,
+		Events:     []LogEvent{},
 	}
 }
 
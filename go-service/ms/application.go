@@ -9,21 +9,30 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/sing3demons/go-service/client"
 	"github.com/sing3demons/go-service/logger"
 	"github.com/sing3demons/go-service/middleware"
 	"go.uber.org/zap"
 )
 
 type application struct {
-	config Config
-	logger *zap.Logger
-	router *mux.Router
+	config    Config
+	logger    *zap.Logger
+	router    *mux.Router
+	admin     *mux.Router
+	registry  *prometheus.Registry
+	health    *healthRegistry
+	lifecycle lifecycle
+	redis     *redis.Client
+	redisOnce sync.Once
 }
 
 type Config struct {
@@ -31,6 +40,26 @@ type Config struct {
 	Db       DbConfig
 	Env      string
 	RedisCfg RedisConfig
+	// ResultCodes override the result code catalogue of the response envelope, keyed by http status
+	ResultCodes map[int]middleware.ResultCode
+	Health      HealthConfig
+	Server      ServerConfig
+	TLS         TLSConfig
+	// HTTP2 enable h2c (HTTP/2 without TLS), HTTP/2 is always enabled with TLS
+	HTTP2 bool
+	// AdminAddr serve /metrics, health checks and pprof on a separate port, they are removed from the public port
+	AdminAddr string
+	// CORS enable CORS headers and preflight handling when set
+	CORS *middleware.CORSConfig
+	// SecureHeaders enable HSTS, CSP, X-Content-Type-Options, ... when set
+	SecureHeaders *middleware.SecureHeadersConfig
+	// MaxBodyBytes reject larger request bodies with 413, 0 means no limit
+	MaxBodyBytes int64
+	// RequestTimeout is the default deadline of every route, a route can replace it with middleware.Timeout
+	// or remove it with middleware.NoTimeout
+	RequestTimeout time.Duration
+	// Compression enable gzip, deflate, br and zstd responses when set
+	Compression *middleware.CompressConfig
 }
 
 type RedisConfig struct {
@@ -52,82 +81,130 @@ func NewApplication(cfg Config) *application {
 	prometheus.Register(responseStatus)
 	prometheus.Register(httpDuration)
 
+	if len(cfg.ResultCodes) > 0 {
+		middleware.SetResultCodes(cfg.ResultCodes)
+	}
+
 	r := mux.NewRouter()
 
+	ops := r
+	var admin *mux.Router
+	if cfg.AdminAddr != "" {
+		admin = mux.NewRouter()
+		registerPprof(admin)
+		ops = admin
+	}
+
 	reg := prometheus.NewRegistry()
 	// m := NewMetrics(reg)
+	reg.MustRegister(middleware.PanicTotal)
+	reg.MustRegister(client.Metrics()...)
+	reg.MustRegister(client.BreakerMetrics()...)
 	promHandler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
-	r.Handle("/metrics", promHandler)
+	ops.Handle("/metrics", promHandler)
+
+	health := newHealthRegistry(cfg.Health)
+	ops.HandleFunc("/healthz", health.livenessHandler).Methods(http.MethodGet)
+	ops.HandleFunc("/readyz", health.readinessHandler).Methods(http.MethodGet)
 
 	r.Use(middleware.Logger)
-	return &application{
-		config: cfg,
-		logger: logger.NewLogger(),
-		router: r,
+	r.Use(middleware.Recovery)
+	if cfg.RequestTimeout > 0 {
+		r.Use(middleware.Timeout(cfg.RequestTimeout))
 	}
-}
-
-func (app *application) Run() error {
-
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%s", app.config.Addr),
-		Handler:      app.router,
-		WriteTimeout: time.Second * 30,
-		ReadTimeout:  time.Second * 10,
-		IdleTimeout:  time.Minute,
+	app := &application{
+		config:   cfg,
+		logger:   logger.NewLogger(),
+		router:   r,
+		admin:    admin,
+		registry: reg,
+		health:   health,
 	}
 
-	shutdown := make(chan error)
-
-	go func() {
-		quit := make(chan os.Signal, 1)
+	app.RegisterHealthCheck("circuit-breakers", client.BreakerHealthCheck(), false)
+	if cfg.RedisCfg.Enabled && cfg.RedisCfg.Addr != "" {
+		app.RegisterHealthCheck("redis", TCPHealthCheck(cfg.RedisCfg.Addr), true)
+	}
 
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-		s := <-quit
+	return app
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+func (app *application) Run() error {
+	servers, err := app.newServers()
+	if err != nil {
+		return err
+	}
 
-		app.logger.Info("shutting down server", zap.String("signal", s.String()))
+	if err := app.start(); err != nil {
+		return err
+	}
 
-		shutdown <- srv.Shutdown(ctx)
-	}()
+	serverErrors := make(chan error, len(servers))
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
 
 	hostName, _ := os.Hostname()
 	platform := runtime.GOOS
 	arch := runtime.GOARCH
 	cpus := runtime.NumCPU()
-	totalMemory := runtime.NumGoroutine()
-	freeMemory := runtime.NumGoroutine()
-	uptime := time.Since(time.Now())
 	pid := os.Getpid()
+	build := readBuildInfo()
 
 	detail := map[string]interface{}{
-		"startTime":    time.Now().Format(time.RFC3339),
-		"addr":         app.config.Addr,
-		"env":          app.config.Env,
-		"app_name":     os.Getenv("SERVICE_NAME"),
-		"hostname":     hostName,
-		"pid":          fmt.Sprintf("%d", os.Getpid()),
-		"platform":     platform,
-		"arch":         arch,
-		"cpus":         cpus,
-		"total_memory": totalMemory,
-		"free_memory":  freeMemory,
-		"uptime":       uptime,
-		"service_pid":  fmt.Sprintf("%d", pid),
-		"go_version":   runtime.Version(),
+		"startTime":   time.Now().Format(time.RFC3339),
+		"addr":        app.config.Addr,
+		"admin_addr":  app.config.AdminAddr,
+		"tls":         app.config.TLS.enabled(),
+		"http2":       app.config.HTTP2 || app.config.TLS.enabled(),
+		"env":         app.config.Env,
+		"app_name":    os.Getenv("SERVICE_NAME"),
+		"version":     build.Version,
+		"build":       build,
+		"hostname":    hostName,
+		"pid":         fmt.Sprintf("%d", pid),
+		"platform":    platform,
+		"arch":        arch,
+		"cpus":        cpus,
+		"gomaxprocs":  runtime.GOMAXPROCS(0),
+		"memory":      readMemoryStats(),
+		"service_pid": fmt.Sprintf("%d", pid),
+		"go_version":  runtime.Version(),
 	}
 	jsonDetail, _ := json.Marshal(detail)
 	app.logger.Info(fmt.Sprintf("server is listening on port %s", app.config.Addr))
+	if app.admin != nil {
+		app.logger.Info(fmt.Sprintf("admin server is listening on port %s", app.config.AdminAddr))
+	}
 	app.logger.Info(string(jsonDetail))
 
-	err := srv.ListenAndServe()
-	if !errors.Is(err, http.ErrServerClosed) {
+	for _, s := range servers {
+		go func(s *server) {
+			serverErrors <- s.serve()
+		}(s)
+	}
+
+	select {
+	case err := <-serverErrors:
+		// a server failed to start, stop the others before returning
+		app.shutdown(servers)
+		app.stop()
 		return err
+	case s := <-quit:
+		app.logger.Info("shutting down server", zap.String("signal", s.String()))
+	}
+
+	// fail readiness first so load balancers stop sending new requests
+	app.health.shuttingDown.Store(true)
+	if app.config.Health.DrainDelay > 0 {
+		app.logger.Info("draining", zap.Duration("delay", app.config.Health.DrainDelay))
+		time.Sleep(app.config.Health.DrainDelay)
 	}
 
-	err = <-shutdown
+	err = app.shutdown(servers)
+	if stopErr := app.stop(); stopErr != nil {
+		err = errors.Join(err, stopErr)
+	}
 	if err != nil {
 		return err
 	}
@@ -137,6 +214,39 @@ func (app *application) Run() error {
 	return nil
 }
 
+// handler wrap the router with the middlewares that must run before routing
+func (app *application) handler() http.Handler {
+	var h http.Handler = app.router
+	// outside the router so middleware.Logger record the uncompressed body
+	if app.config.Compression != nil {
+		h = middleware.Compress(*app.config.Compression)(h)
+	}
+	if app.config.MaxBodyBytes > 0 {
+		h = middleware.MaxBodySize(app.config.MaxBodyBytes)(h)
+	}
+	if app.config.CORS != nil {
+		h = middleware.CORS(*app.config.CORS)(h)
+	}
+	if app.config.SecureHeaders != nil {
+		h = middleware.SecureHeaders(*app.config.SecureHeaders)(h)
+	}
+	return h
+}
+
+// shutdown gracefully stop all servers within the shutdown timeout
+func (app *application) shutdown(servers []*server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), app.config.Server.withDefaults().ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, s := range servers {
+		if err := s.srv.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s server: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (m *application) Log(tag string, msg string) {
 	m.logger.Info(fmt.Sprintf("[%s]: %s", tag, msg))
 }
@@ -145,32 +255,80 @@ func (m *application) Use(middleware func(http.Handler) http.Handler) {
 	m.router.Use(middleware)
 }
 
-func (m *application) GET(path string, h ServiceHandleFunc) *mux.Route {
-	return m.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		h(NewHTTPContext(w, r))
-	}).Methods(http.MethodGet)
+func (m *application) GET(path string, h ServiceHandleFunc, middlewares ...func(http.Handler) http.Handler) *mux.Route {
+	return m.Handle(http.MethodGet, path, serviceHandler(h), middlewares...)
 }
 
-func (m *application) POST(path string, h ServiceHandleFunc) *mux.Route {
-	return m.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		h(NewHTTPContext(w, r))
-	}).Methods(http.MethodPost)
+func (m *application) POST(path string, h ServiceHandleFunc, middlewares ...func(http.Handler) http.Handler) *mux.Route {
+	return m.Handle(http.MethodPost, path, serviceHandler(h), middlewares...)
 }
 
-func (m *application) PUT(path string, h ServiceHandleFunc) *mux.Route {
-	return m.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		h(NewHTTPContext(w, r))
-	}).Methods(http.MethodPut)
+func (m *application) PUT(path string, h ServiceHandleFunc, middlewares ...func(http.Handler) http.Handler) *mux.Route {
+	return m.Handle(http.MethodPut, path, serviceHandler(h), middlewares...)
 }
 
-func (m *application) DELETE(path string, h ServiceHandleFunc) *mux.Route {
-	return m.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		h(NewHTTPContext(w, r))
-	}).Methods(http.MethodDelete)
+func (m *application) DELETE(path string, h ServiceHandleFunc, middlewares ...func(http.Handler) http.Handler) *mux.Route {
+	return m.Handle(http.MethodDelete, path, serviceHandler(h), middlewares...)
 }
 
-func (m *application) PATCH(path string, h ServiceHandleFunc) *mux.Route {
-	return m.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+func (m *application) PATCH(path string, h ServiceHandleFunc, middlewares ...func(http.Handler) http.Handler) *mux.Route {
+	return m.Handle(http.MethodPatch, path, serviceHandler(h), middlewares...)
+}
+
+// Handle mount a raw http.Handler, an empty method match every method.
+// The middlewares only apply to this route, the first one is the outermost.
+func (m *application) Handle(method string, path string, h http.Handler, middlewares ...func(http.Handler) http.Handler) *mux.Route {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	route := m.router.Handle(path, h)
+	if method != "" {
+		route.Methods(method)
+	}
+	return route
+}
+
+// HandleFunc mount a raw http.HandlerFunc, an empty method match every method
+func (m *application) HandleFunc(method string, path string, f func(http.ResponseWriter, *http.Request), middlewares ...func(http.Handler) http.Handler) *mux.Route {
+	return m.Handle(method, path, http.HandlerFunc(f), middlewares...)
+}
+
+func serviceHandler(h ServiceHandleFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		h(NewHTTPContext(w, r))
-	}).Methods(http.MethodPatch)
+	})
+}
+
+// RateLimit build a rate limit middleware for the route helpers,
+// the limits are shared through redis when RedisCfg is enabled
+func (m *application) RateLimit(cfg middleware.RateLimitConfig) func(http.Handler) http.Handler {
+	if cfg.Store == nil {
+		if client := m.Redis(); client != nil {
+			cfg.Store = middleware.NewRedisRateLimitStore(client)
+		}
+	}
+	return middleware.RateLimit(cfg)
+}
+
+// Idempotency build an idempotency middleware for the route helpers,
+// the responses are shared through redis when RedisCfg is enabled
+func (m *application) Idempotency(cfg middleware.IdempotencyConfig) func(http.Handler) http.Handler {
+	if cfg.Store == nil {
+		if client := m.Redis(); client != nil {
+			cfg.Store = middleware.NewRedisIdempotencyStore(client)
+		}
+	}
+	return middleware.Idempotency(cfg)
+}
+
+// NewCache build a response cache, use its Middleware with the route helpers and
+// Invalidate/InvalidateTags after writes. Entries are shared through redis when RedisCfg is enabled.
+func (m *application) NewCache(cfg middleware.CacheConfig) *middleware.Cache {
+	if cfg.TTL > 0 && cfg.Store == nil {
+		if client := m.Redis(); client != nil {
+			cfg.Store = middleware.NewRedisCacheStore(client)
+		}
+	}
+	return middleware.NewCache(cfg)
 }
@@ -1,9 +1,16 @@
 package ms
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sing3demons/go-service/logger"
+	"github.com/sing3demons/go-service/middleware"
 )
 
 func (ms *application) newKafkaConsumer(servers string, groupID string) (*kafka.Consumer, error) {
@@ -62,32 +69,63 @@ type consumerContext struct {
 	readTimeout time.Duration
 }
 
-func (ms *application) consumeSingle(ctx consumerContext, h func(*ConsumerContext)) {
-	c, err := ms.newKafkaConsumer(ctx.servers, ctx.groupID)
-	if err != nil {
-		return
-	}
+// pollTimeout is the read timeout used when no timeout is configured, it lets the consumer stop
+const pollTimeout = 500 * time.Millisecond
 
-	defer c.Close()
+// consumer read messages until it is stopped, it implements Component
+type consumer struct {
+	ms   *application
+	ctx  consumerContext
+	h    func(*ConsumerContext)
+	stop chan struct{}
+	done chan struct{}
+}
 
-	c.Subscribe(ctx.topic, nil)
+func (c *consumer) Start(ctx context.Context) error {
+	kc, err := c.ms.newKafkaConsumer(c.ctx.servers, c.ctx.groupID)
+	if err != nil {
+		return err
+	}
 
-	for {
-		ms.processMessage(ctx, c, h)
+	if len(c.ctx.topics) > 0 {
+		err = kc.SubscribeTopics(c.ctx.topics, nil)
+	} else {
+		err = kc.Subscribe(c.ctx.topic, nil)
 	}
-}
-func (ms *application) consumeMultiple(ctx consumerContext, h func(*ConsumerContext)) {
-	c, err := ms.newKafkaConsumer(ctx.servers, ctx.groupID)
 	if err != nil {
-		return
+		kc.Close()
+		return err
 	}
 
-	defer c.Close()
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		defer kc.Close()
 
-	c.SubscribeTopics(ctx.topics, nil)
+		for {
+			select {
+			case <-c.stop:
+				return
+			default:
+				c.ms.processMessage(c.ctx, kc, c.h)
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *consumer) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	close(c.stop)
 
-	for {
-		ms.processMessage(ctx, c, h)
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -99,31 +137,61 @@ type kafkaMessage struct {
 }
 
 func (ms *application) processMessage(ctx consumerContext, c *kafka.Consumer, h func(*ConsumerContext)) {
-	if ctx.readTimeout <= 0 {
-		// readtimeout -1 indicates no timeout
-		ctx.readTimeout = -1
+	readTimeout := ctx.readTimeout
+	if readTimeout <= 0 {
+		// no timeout, poll so the consumer can be stopped
+		readTimeout = pollTimeout
 	}
 
-	msg, err := c.ReadMessage(ctx.readTimeout)
+	msg, err := c.ReadMessage(readTimeout)
 	if err != nil {
 		ms.handleKafkaError(ctx, err)
 		return
 	}
 
 	// Execute Handler
-	h(NewConsumerContext(kafkaMessage{
+	ms.handleMessage(NewConsumerContext(kafkaMessage{
 		topic:     *msg.TopicPartition.Topic,
 		timestamp: msg.Timestamp,
 		value:     string(msg.Value),
 		key:       string(msg.Key),
-	}, ms))
+	}, ms), h)
+}
+
+// handleMessage run the handler, a panic is logged and the consumer keep reading
+func (ms *application) handleMessage(c *ConsumerContext, h func(*ConsumerContext)) {
+	startTime := time.Now()
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		middleware.LogPanic(c.Context(), "consumer", c.message.topic, v, debug.Stack())
+
+		hostName, _ := os.Hostname()
+		code := middleware.GetResultCode(http.StatusInternalServerError)
+		go logger.ToSummaryLog(logger.Summary{
+			Hostname:   hostName,
+			Appname:    os.Getenv("SERVICE_NAME"),
+			Ssid:       c.message.topic,
+			Intime:     startTime.Format(time.RFC3339),
+			Invoke:     logger.GetInvoke(c.Context()),
+			Input:      c.message.value,
+			Output:     fmt.Sprint(v),
+			Status:     http.StatusInternalServerError,
+			ResultCode: code.Code,
+		})
+	}()
+
+	h(c)
 }
 
 func (ms *application) handleKafkaError(ctx consumerContext, err error) {
 	kafkaErr, ok := err.(kafka.Error)
 	if ok {
 		if kafkaErr.Code() == kafka.ErrTimedOut {
-			if ctx.readTimeout == -1 {
+			if ctx.readTimeout <= 0 {
 				// No timeout just continue to read message again
 				return
 			}
@@ -132,13 +200,18 @@ func (ms *application) handleKafkaError(ctx consumerContext, err error) {
 	ms.Log("Consumer", err.Error())
 }
 
-// Consume register service endpoint for Consumer service
+// Consume register service endpoint for Consumer service, the consumer is started by Run
 func (ms *application) Consume(servers string, topic string, groupID string, h func(*ConsumerContext)) error {
-	go ms.consumeSingle(consumerContext{
-		servers:     servers,
-		topic:       topic,
-		groupID:     groupID,
-		readTimeout: time.Duration(-1),
-	}, h)
+	name := fmt.Sprintf("consumer-%d:%s", len(ms.lifecycle.components), topic)
+	ms.Register(name, &consumer{
+		ms: ms,
+		ctx: consumerContext{
+			servers:     servers,
+			topic:       topic,
+			groupID:     groupID,
+			readTimeout: time.Duration(-1),
+		},
+		h: h,
+	})
 	return nil
 }
@@ -0,0 +1,39 @@
+package ms
+
+import "context"
+
+// IContext is the transport-agnostic context shared by HTTP and consumer handlers
+type IContext interface {
+	// Context return the request scoped context (session, trace and span ids)
+	Context() context.Context
+	// Info log a message with the session of the request or message
+	Info(message string)
+	// Param return parameter by name
+	Param(name string) string
+	// ReadInput return the raw input (request body or message value)
+	ReadInput() string
+	// Response return response to client
+	Response(responseCode int, responseData interface{})
+}
+
+// HandleFunc is a handler that can be mounted on both HTTP routes and consumers
+type HandleFunc func(c IContext)
+
+var (
+	_ IContext = (*HTTPContext)(nil)
+	_ IContext = (*ConsumerContext)(nil)
+)
+
+// HTTPHandler adapts a HandleFunc to be used with app.GET, app.POST, ...
+func HTTPHandler(h HandleFunc) ServiceHandleFunc {
+	return func(c HTTPContext) {
+		h(&c)
+	}
+}
+
+// ConsumerHandler adapts a HandleFunc to be used with app.Consume
+func ConsumerHandler(h HandleFunc) func(*ConsumerContext) {
+	return func(c *ConsumerContext) {
+		h(c)
+	}
+}
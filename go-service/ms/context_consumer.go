@@ -1,25 +1,56 @@
 package ms
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/sing3demons/go-service/constants"
+	"github.com/sing3demons/go-service/logger"
+	"go.uber.org/zap"
+)
 
 type ConsumerContext struct {
 	message kafkaMessage
 	ms      *application
+	ctx     context.Context
 }
 
 // NewConsumerContext is the constructor function for ConsumerContext
 func NewConsumerContext(message kafkaMessage, ms *application) *ConsumerContext {
+	session := uuid.New().String()
+
+	ctx := context.WithValue(context.Background(), constants.Session, session)
+	ctx = context.WithValue(ctx, constants.TraceIDKey, logger.NewTraceID())
+	ctx = context.WithValue(ctx, constants.SpanIDKey, logger.NewSpanID())
+	ctx = logger.SetInvoke(ctx, session)
+
 	return &ConsumerContext{
 		message: message,
 		ms:      ms,
+		ctx:     ctx,
 	}
 }
 
+// Context return the context of the message
+func (ctx *ConsumerContext) Context() context.Context {
+	return ctx.ctx
+}
+
 // Log will log a message
 func (ctx *ConsumerContext) Log(message string) {
 	fmt.Println("Consumer: ", message)
 }
 
+// Info log a message with the session of the message through the application logger
+func (ctx *ConsumerContext) Info(message string) {
+	session, _ := ctx.ctx.Value(constants.Session).(string)
+	ctx.ms.logger.Info(message,
+		zap.String("topic", ctx.message.topic),
+		zap.String("session", session),
+	)
+}
+
 // Param return parameter by name (empty in case of Consumer)
 func (ctx *ConsumerContext) Param(name string) string {
 	return ""
@@ -1,11 +1,16 @@
 package ms
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 
+	"github.com/gorilla/mux"
 	"github.com/sing3demons/go-service/constants"
 	"github.com/sing3demons/go-service/logger"
+	"github.com/sing3demons/go-service/middleware"
 	"github.com/sing3demons/go-service/mlog"
 )
 
@@ -25,8 +30,12 @@ func NewHTTPContext(res http.ResponseWriter, req *http.Request) HTTPContext {
 	}
 }
 
+// L return the detail log of the request, it is created on first use
 func (h *HTTPContext) L() *mlog.DetailLog {
-	return mlog.NewDetailLog(h.Req)
+	if h.Log == nil {
+		h.Log = mlog.NewDetailLog(h.Req)
+	}
+	return h.Log
 }
 
 func (h *HTTPContext) DetailLog(initInvoke string, scenario string, identity string) logger.DetailLog {
@@ -35,11 +44,50 @@ func (h *HTTPContext) DetailLog(initInvoke string, scenario string, identity str
 	return l
 }
 
+// Context return the request context
+func (h *HTTPContext) Context() context.Context {
+	return h.Req.Context()
+}
+
+// Info add the message to the detail log of the request
+func (h *HTTPContext) Info(message string) {
+	h.L().AddEvent("log", map[string]interface{}{
+		"message": message,
+	})
+}
+
+// Param return path parameter by name
+func (h *HTTPContext) Param(name string) string {
+	return mux.Vars(h.Req)[name]
+}
+
+// ReadInput return request body, the body can be read again afterwards
+func (h *HTTPContext) ReadInput() string {
+	if h.Req.Body == nil {
+		return ""
+	}
+
+	body, _ := io.ReadAll(h.Req.Body)
+	h.Req.Body.Close()
+	h.Req.Body = io.NopCloser(bytes.NewBuffer(body))
+	return string(body)
+}
+
+// Response return response to client
+func (h *HTTPContext) Response(responseCode int, responseData interface{}) {
+	h.JSON(responseCode, responseData)
+}
+
 func (h *HTTPContext) JSON(code int, data interface{}) {
 	h.Res.Header().Set(constants.ContentType, constants.ContentTypeJSON)
 	h.Res.WriteHeader(code)
 	json.NewEncoder(h.Res).Encode(data)
 
+	h.end()
+}
+
+// end flush the detail logs once the response is written
+func (h *HTTPContext) end() {
 	if h.l != nil {
 		log := *h.l
 		log.AutoEnd()
@@ -50,26 +98,62 @@ func (h *HTTPContext) JSON(code int, data interface{}) {
 	}
 }
 
-func (b *HTTPContext) Error(code int, err error) {
-	data := map[string]interface{}{
-		"message": err.Error(),
-	}
+// OK write the standard envelope with status 200
+func (h *HTTPContext) OK(data interface{}) {
+	h.JSON(http.StatusOK, middleware.NewResponse(http.StatusOK, data))
+}
+
+// Created write the standard envelope with status 201
+func (h *HTTPContext) Created(data interface{}) {
+	h.JSON(http.StatusCreated, middleware.NewResponse(http.StatusCreated, data))
+}
+
+// Fail write the standard envelope with the given result code and description
+func (h *HTTPContext) Fail(code int, resultCode string, desc string) {
+	h.L().AddEvent("error", map[string]interface{}{
+		"resultCode": resultCode,
+		"resultDesc": desc,
+	})
+
+	h.JSON(code, middleware.HandlerResponse{
+		ResultCode: resultCode,
+		ResultDesc: desc,
+	})
+}
 
-	if b.Log != nil {
-		b.Log.AddEvent("error", data)
+// List write the standard envelope with items and pagination
+func (h *HTTPContext) List(items interface{}, page middleware.Pagination) {
+	if page.PageSize > 0 && page.TotalPages == 0 {
+		page.TotalPages = (page.Total + page.PageSize - 1) / page.PageSize
 	}
 
-	b.JSON(code, data)
+	h.OK(middleware.ListData{
+		Items:      items,
+		Pagination: page,
+	})
+}
+
+// Error write the standard envelope of http status, the error is returned as developerMessage
+func (b *HTTPContext) Error(code int, err error) {
+	res := middleware.NewResponse(code, nil)
+	res.DeveloperMessage = err.Error()
+
+	b.L().AddEvent("error", map[string]interface{}{
+		"message": err.Error(),
+	})
+
+	b.JSON(code, res)
 }
 
 func (b *HTTPContext) AddLogClient(data map[string]any) {
-	b.Log.AddEvent("client.output", data)
+	b.L().AddEvent("client.output", data)
 }
 
 func (b *HTTPContext) AddInputLogClient(data any) {
-	b.Log.AddEvent("client.input", data)
+	b.L().AddEvent("client.input", data)
 }
 
 func (h *HTTPContext) GetSession() string {
-	return h.Req.Context().Value(constants.Session).(string)
+	session, _ := h.Req.Context().Value(constants.Session).(string)
+	return session
 }
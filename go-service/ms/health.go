@@ -0,0 +1,219 @@
+package ms
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sing3demons/go-service/middleware"
+)
+
+// HealthCheckFunc return an error when the dependency is not healthy
+type HealthCheckFunc func(ctx context.Context) error
+
+type HealthConfig struct {
+	// Timeout of each health check, default 2s
+	Timeout time.Duration
+	// DrainDelay is the time readiness report failing before the server stop accepting connections,
+	// it gives load balancers time to remove the instance
+	DrainDelay time.Duration
+}
+
+type healthCheck struct {
+	name     string
+	check    HealthCheckFunc
+	critical bool
+}
+
+type healthRegistry struct {
+	mu           sync.RWMutex
+	checks       []healthCheck
+	shuttingDown atomic.Bool
+	timeout      time.Duration
+}
+
+type HealthStatus struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthStatus `json:"checks,omitempty"`
+}
+
+const (
+	healthUp       = "UP"
+	healthDown     = "DOWN"
+	healthDegraded = "DEGRADED"
+)
+
+func newHealthRegistry(cfg HealthConfig) *healthRegistry {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	return &healthRegistry{timeout: cfg.Timeout}
+}
+
+// RegisterHealthCheck add a dependency check to /readyz,
+// a failing critical check make the instance not ready, a failing non-critical check only degrade it
+func (app *application) RegisterHealthCheck(name string, check func(ctx context.Context) error, critical bool) {
+	app.health.mu.Lock()
+	defer app.health.mu.Unlock()
+	app.health.checks = append(app.health.checks, healthCheck{name: name, check: check, critical: critical})
+}
+
+func (h *healthRegistry) run(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	checks := make([]healthCheck, len(h.checks))
+	copy(checks, h.checks)
+	h.mu.RUnlock()
+
+	report := HealthReport{Status: healthUp, Checks: make(map[string]HealthStatus, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c healthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(ctx)
+			status := HealthStatus{
+				Status:   healthUp,
+				Critical: c.critical,
+				Duration: time.Since(start).String(),
+			}
+			if err != nil {
+				status.Status = healthDown
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = status
+			if err != nil {
+				if c.critical {
+					report.Status = healthDown
+				} else if report.Status == healthUp {
+					report.Status = healthDegraded
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// livenessHandler report the process is alive, it never check dependencies
+func (h *healthRegistry) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.WriteResponse(w, http.StatusOK, middleware.NewResponse(http.StatusOK, HealthReport{Status: healthUp}))
+}
+
+// Liveness is the liveness check as a route handler, to expose it on the service router as well as /healthz
+func (app *application) Liveness(c HTTPContext) {
+	c.OK(HealthReport{Status: healthUp})
+}
+
+// readinessHandler report whether the instance can receive traffic
+func (h *healthRegistry) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown.Load() {
+		res := middleware.NewResponse(http.StatusServiceUnavailable, HealthReport{Status: healthDown})
+		res.DeveloperMessage = "server is shutting down"
+		middleware.WriteResponse(w, http.StatusServiceUnavailable, res)
+		return
+	}
+
+	report := h.run(r.Context())
+	code := http.StatusOK
+	if report.Status == healthDown {
+		code = http.StatusServiceUnavailable
+	}
+	middleware.WriteResponse(w, code, middleware.NewResponse(code, report))
+}
+
+// KafkaHealthCheck check the brokers are reachable by fetching the cluster metadata,
+// the admin client is closed when the application stops
+func (app *application) KafkaHealthCheck(servers string) HealthCheckFunc {
+	var mu sync.Mutex
+	var admin *kafka.AdminClient
+	var closed bool
+
+	app.OnStop("kafka-health-check", func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		closed = true
+		if admin != nil {
+			admin.Close()
+			admin = nil
+		}
+		return nil
+	})
+
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if closed {
+			return errors.New("kafka health check is closed")
+		}
+		if admin == nil {
+			a, err := kafka.NewAdminClient(&kafka.ConfigMap{
+				"bootstrap.servers": servers,
+				"security.protocol": "plaintext",
+			})
+			if err != nil {
+				return err
+			}
+			admin = a
+		}
+
+		timeout := 2 * time.Second
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = max(time.Until(deadline), 0)
+		}
+
+		_, err := admin.GetMetadata(nil, false, int(timeout.Milliseconds()))
+		return err
+	}
+}
+
+// TCPHealthCheck check a tcp address accept connections, it is used for redis and databases
+// until a native client is available
+func TCPHealthCheck(addr string) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// Pinger is implemented by *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingHealthCheck check a database connection pool
+func PingHealthCheck(p Pinger) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		if p == nil {
+			return errors.New("pinger is nil")
+		}
+		return p.PingContext(ctx)
+	}
+}
@@ -0,0 +1,244 @@
+package ms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultHookTimeout = 15 * time.Second
+
+// Component is a resource started before the servers and stopped after them,
+// e.g. producers, consumers, clients and database pools
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// ComponentFunc build a Component from functions, nil functions are skipped
+type ComponentFunc struct {
+	StartFunc func(ctx context.Context) error
+	StopFunc  func(ctx context.Context) error
+}
+
+func (c ComponentFunc) Start(ctx context.Context) error {
+	if c.StartFunc == nil {
+		return nil
+	}
+	return c.StartFunc(ctx)
+}
+
+func (c ComponentFunc) Stop(ctx context.Context) error {
+	if c.StopFunc == nil {
+		return nil
+	}
+	return c.StopFunc(ctx)
+}
+
+type component struct {
+	name      string
+	component Component
+	dependsOn []string
+}
+
+type hook struct {
+	name    string
+	fn      func(ctx context.Context) error
+	order   int
+	timeout time.Duration
+	seq     int
+}
+
+type HookOption func(*hook)
+
+// WithOrder set the order of a hook, lower order run first (default 0)
+func WithOrder(order int) HookOption {
+	return func(h *hook) {
+		h.order = order
+	}
+}
+
+// WithTimeout set the timeout of a hook (default 15s)
+func WithTimeout(timeout time.Duration) HookOption {
+	return func(h *hook) {
+		h.timeout = timeout
+	}
+}
+
+type lifecycle struct {
+	components []component
+	onStart    []hook
+	onStop     []hook
+	started    []component
+}
+
+func newHook(name string, fn func(ctx context.Context) error, seq int, opts []HookOption) hook {
+	h := hook{name: name, fn: fn, timeout: defaultHookTimeout, seq: seq}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	return h
+}
+
+// OnStart register a hook that run after the components are started and before the servers listen
+func (app *application) OnStart(name string, fn func(ctx context.Context) error, opts ...HookOption) {
+	app.lifecycle.onStart = append(app.lifecycle.onStart, newHook(name, fn, len(app.lifecycle.onStart), opts))
+}
+
+// OnStop register a hook that run after the servers are shut down and before the components are stopped.
+// Hooks with the same order run in reverse registration order.
+func (app *application) OnStop(name string, fn func(ctx context.Context) error, opts ...HookOption) {
+	app.lifecycle.onStop = append(app.lifecycle.onStop, newHook(name, fn, -len(app.lifecycle.onStop), opts))
+}
+
+// Register add a component to the registry, it is started after its dependencies and stopped before them
+func (app *application) Register(name string, c Component, dependsOn ...string) {
+	app.lifecycle.components = append(app.lifecycle.components, component{name: name, component: c, dependsOn: dependsOn})
+}
+
+// sortComponents order the components so dependencies come first
+func sortComponents(components []component) ([]component, error) {
+	byName := make(map[string]component, len(components))
+	for _, c := range components {
+		if _, ok := byName[c.name]; ok {
+			return nil, fmt.Errorf("component %s is registered twice", c.name)
+		}
+		byName[c.name] = c
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(components))
+	sorted := make([]component, 0, len(components))
+
+	var visit func(c component, path []string) error
+	visit = func(c component, path []string) error {
+		switch state[c.name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("component dependency cycle: %s", strings.Join(append(path, c.name), " -> "))
+		}
+		state[c.name] = visiting
+		for _, dep := range c.dependsOn {
+			d, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("component %s depends on unknown component %s", c.name, dep)
+			}
+			if err := visit(d, append(path, c.name)); err != nil {
+				return err
+			}
+		}
+		state[c.name] = visited
+		sorted = append(sorted, c)
+		return nil
+	}
+
+	for _, c := range components {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+func sortHooks(hooks []hook) []hook {
+	sorted := make([]hook, len(hooks))
+	copy(sorted, hooks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].order != sorted[j].order {
+			return sorted[i].order < sorted[j].order
+		}
+		return sorted[i].seq < sorted[j].seq
+	})
+	return sorted
+}
+
+func runHook(name string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", name, ctx.Err())
+	}
+}
+
+// start the components in dependency order then run the start hooks,
+// on failure everything already started is stopped
+func (app *application) start() error {
+	components, err := sortComponents(app.lifecycle.components)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range components {
+		if err := runHook("start "+c.name, defaultHookTimeout, c.component.Start); err != nil {
+			app.stopComponents()
+			return err
+		}
+		app.lifecycle.started = append(app.lifecycle.started, c)
+		app.logger.Info("component started", zap.String("name", c.name))
+	}
+
+	for _, h := range sortHooks(app.lifecycle.onStart) {
+		if err := runHook("start hook "+h.name, h.timeout, h.fn); err != nil {
+			app.stopComponents()
+			return err
+		}
+	}
+	return nil
+}
+
+// stop run the stop hooks then stop the started components
+func (app *application) stop() error {
+	var errs []error
+	for _, h := range sortHooks(app.lifecycle.onStop) {
+		if err := runHook("stop hook "+h.name, h.timeout, h.fn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := app.stopComponents(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// stopComponents stop the started components in reverse dependency order
+func (app *application) stopComponents() error {
+	var errs []error
+	timeout := app.config.Server.withDefaults().ShutdownTimeout
+	for i := len(app.lifecycle.started) - 1; i >= 0; i-- {
+		c := app.lifecycle.started[i]
+		if err := runHook("stop "+c.name, timeout, c.component.Stop); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		app.logger.Info("component stopped", zap.String("name", c.name))
+	}
+	app.lifecycle.started = nil
+
+	err := errors.Join(errs...)
+	if err != nil {
+		app.logger.Error("stop", zap.Error(err))
+	}
+	return err
+}
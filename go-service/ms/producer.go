@@ -1,7 +1,12 @@
 package ms
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 )
@@ -13,10 +18,17 @@ type IProducer interface {
 	Close() error
 }
 
+// ErrProducerClosed is returned by the sends made after Stop or Close
+var ErrProducerClosed = errors.New("producer is closed")
+
 type Producer struct {
 	ms      *application
 	servers string
-	prod    *kafka.Producer
+
+	mu       sync.Mutex
+	prod     *kafka.Producer
+	closed   bool
+	inflight sync.WaitGroup
 }
 
 func NewProducer(servers string, ms *application) *Producer {
@@ -26,16 +38,55 @@ func NewProducer(servers string, ms *application) *Producer {
 	}
 }
 
-func (p *Producer) getProducer() *kafka.Producer {
+// acquire return the kafka producer, created on first use, and count a send in flight.
+// Every successful acquire must be followed by p.inflight.Done.
+func (p *Producer) acquire() (*kafka.Producer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrProducerClosed
+	}
 	if p.prod == nil {
-		prod, _ := p.newKafkaProducer(p.servers)
+		prod, err := p.newKafkaProducer(p.servers)
+		if err != nil {
+			return nil, err
+		}
 		p.prod = prod
 	}
-	return p.prod
+	p.inflight.Add(1)
+	return p.prod, nil
 }
 
 // SendMessage send message to topic synchronously
 func (p *Producer) SendMessage(topic string, key string, message interface{}) error {
+	prod, err := p.acquire()
+	if err != nil {
+		return err
+	}
+	defer p.inflight.Done()
+
+	return p.send(prod, topic, key, message)
+}
+
+// SendMessageAsync send message to topic in the background, delivery errors are logged.
+// Stop wait for the messages accepted here before closing the producer.
+func (p *Producer) SendMessageAsync(topic string, key string, message interface{}) error {
+	prod, err := p.acquire()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer p.inflight.Done()
+		if err := p.send(prod, topic, key, message); err != nil {
+			p.ms.Log("PROD", fmt.Sprintf("send message to topic %s failed: %v", topic, err))
+		}
+	}()
+	return nil
+}
+
+func (p *Producer) send(prod *kafka.Producer, topic string, key string, message interface{}) error {
 	messageJSON, err := json.Marshal(message)
 	if err != nil {
 		return err
@@ -49,8 +100,6 @@ func (p *Producer) SendMessage(topic string, key string, message interface{}) er
 	// Send Message Synchrounously
 	deliveryChan := make(chan kafka.Event)
 
-	prod := p.getProducer()
-
 	msg := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
 		Value:          messageJSON,
@@ -62,20 +111,81 @@ func (p *Producer) SendMessage(topic string, key string, message interface{}) er
 		return err
 	}
 
-	<-deliveryChan
+	e := <-deliveryChan
 	close(deliveryChan)
 
+	if m, ok := e.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+		return m.TopicPartition.Error
+	}
+	return nil
+}
+
+// Start create the kafka producer, it implements Component
+func (p *Producer) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = false
+	if p.prod != nil {
+		return nil
+	}
+
+	prod, err := p.newKafkaProducer(p.servers)
+	if err != nil {
+		return err
+	}
+	p.prod = prod
 	return nil
 }
 
+// Stop refuse new messages, wait for the ones in flight then flush and close the producer
+// within the context deadline, it implements Component
+func (p *Producer) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	inflight := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(inflight)
+	}()
+	select {
+	case <-inflight:
+	case <-ctx.Done():
+		p.ms.Log("PROD", "messages still in flight at shutdown")
+	}
+
+	flushTimeout := 5 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		// keep some time to close the producer
+		flushTimeout = max(time.Until(deadline)-500*time.Millisecond, 0)
+	}
+	return p.close(flushTimeout)
+}
+
 // Close the producer
 func (p *Producer) Close() error {
-	if p.prod == nil {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	return p.close(5 * time.Second) // 5s for flush message in queue
+}
+
+func (p *Producer) close(flushTimeout time.Duration) error {
+	p.mu.Lock()
+	prod := p.prod
+	p.prod = nil
+	p.mu.Unlock()
+
+	if prod == nil {
 		return nil
 	}
 
-	prod := p.prod
-	prod.Flush(5000) // 5s for flush message in queue
+	if remaining := prod.Flush(int(flushTimeout.Milliseconds())); remaining > 0 {
+		p.ms.Log("PROD", fmt.Sprintf("%d messages are not delivered", remaining))
+	}
 	prod.Close()
 
 	p.ms.Log("PROD", "Close successfully")
@@ -0,0 +1,29 @@
+package ms
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis return the redis client of RedisCfg, it is nil when redis is not enabled.
+// The client is created on first use and closed when the application stop.
+func (app *application) Redis() *redis.Client {
+	if !app.config.RedisCfg.Enabled {
+		return nil
+	}
+
+	app.redisOnce.Do(func() {
+		app.redis = redis.NewClient(&redis.Options{
+			Addr:     app.config.RedisCfg.Addr,
+			Password: app.config.RedisCfg.Pw,
+			DB:       app.config.RedisCfg.Db,
+		})
+		app.Register("redis", ComponentFunc{
+			StopFunc: func(ctx context.Context) error {
+				return app.redis.Close()
+			},
+		})
+	})
+	return app.redis
+}
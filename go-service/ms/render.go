@@ -0,0 +1,248 @@
+package ms
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sing3demons/go-service/constants"
+	"github.com/sing3demons/go-service/middleware"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// XML write data as xml, maps are not supported by encoding/xml and are answered with a 500
+func (h *HTTPContext) XML(code int, data interface{}) {
+	body, err := encodeXML(data)
+	if err != nil {
+		h.Error(http.StatusInternalServerError, err)
+		return
+	}
+	h.Blob(code, constants.ContentTypeXML, body)
+}
+
+// MsgPack write data as msgpack
+func (h *HTTPContext) MsgPack(code int, data interface{}) {
+	body, err := msgpack.Marshal(data)
+	if err != nil {
+		h.Error(http.StatusInternalServerError, err)
+		return
+	}
+	h.Blob(code, constants.ContentTypeMsgPack, body)
+}
+
+// encodeXML encode into a buffer so an unsupported value never produce a truncated 200
+func encodeXML(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// String write a formatted plain text
+func (h *HTTPContext) String(code int, format string, values ...interface{}) {
+	h.Res.Header().Set(constants.ContentType, constants.ContentTypeText)
+	h.Res.WriteHeader(code)
+	if len(values) > 0 {
+		fmt.Fprintf(h.Res, format, values...)
+	} else {
+		io.WriteString(h.Res, format)
+	}
+
+	h.end()
+}
+
+// Blob write raw bytes with the given content type
+func (h *HTTPContext) Blob(code int, contentType string, data []byte) {
+	if contentType == "" {
+		contentType = constants.ContentTypeOctetStream
+	}
+	h.Res.Header().Set(constants.ContentType, contentType)
+	h.Res.WriteHeader(code)
+	h.Res.Write(data)
+
+	h.end()
+}
+
+// File serve a file from disk, Range and If-Modified-Since are handled by http.ServeFile
+func (h *HTTPContext) File(path string) {
+	http.ServeFile(h.Res, h.Req, path)
+
+	h.end()
+}
+
+// Stream write a chunked response, step is called until it return false or the client is gone.
+// The response is flushed after each step.
+func (h *HTTPContext) Stream(code int, contentType string, step func(w io.Writer) bool) bool {
+	if contentType == "" {
+		contentType = constants.ContentTypeOctetStream
+	}
+	h.Res.Header().Set(constants.ContentType, contentType)
+	h.Res.WriteHeader(code)
+
+	defer h.end()
+
+	flusher, _ := h.Res.(http.Flusher)
+	done := h.Req.Context().Done()
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+			keepOpen := step(h.Res)
+			if flusher != nil {
+				flusher.Flush()
+			}
+			if !keepOpen {
+				return false
+			}
+		}
+	}
+}
+
+// SSEvent is a server-sent event
+type SSEvent struct {
+	Id    string
+	Event string
+	Retry int
+	Data  interface{}
+}
+
+// SSE stream events to the client until the channel is closed or the client is gone
+func (h *HTTPContext) SSE(events <-chan SSEvent) {
+	h.Res.Header().Set("Cache-Control", "no-cache")
+	h.Res.Header().Set("Connection", "keep-alive")
+
+	h.Stream(http.StatusOK, constants.ContentTypeEventStream, func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			writeSSEvent(w, ev)
+			return true
+		case <-h.Req.Context().Done():
+			return false
+		}
+	})
+}
+
+func writeSSEvent(w io.Writer, ev SSEvent) {
+	if ev.Id != "" {
+		fmt.Fprintf(w, "id: %s\n", ev.Id)
+	}
+	if ev.Event != "" {
+		fmt.Fprintf(w, "event: %s\n", ev.Event)
+	}
+	if ev.Retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n", ev.Retry)
+	}
+
+	var data string
+	switch v := ev.Data.(type) {
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		b, _ := json.Marshal(v)
+		data = string(b)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	io.WriteString(w, "\n")
+}
+
+// Negotiate write data as json, xml or msgpack depending on the Accept header.
+// json is used when the header is missing, 406 is returned when nothing acceptable can encode data.
+func (h *HTTPContext) Negotiate(code int, data interface{}) {
+	var body []byte
+	var err error
+
+	format := negotiateFormat(h.Req.Header.Get(constants.Accept), constants.ContentTypeJSON, constants.ContentTypeXML, constants.ContentTypeMsgPack)
+	switch format {
+	case constants.ContentTypeJSON:
+		h.JSON(code, data)
+		return
+	case constants.ContentTypeXML:
+		body, err = encodeXML(data)
+	case constants.ContentTypeMsgPack:
+		body, err = msgpack.Marshal(data)
+	default:
+		h.JSON(http.StatusNotAcceptable, middleware.NewResponse(http.StatusNotAcceptable, nil))
+		return
+	}
+
+	if err != nil {
+		res := middleware.NewResponse(http.StatusNotAcceptable, nil)
+		res.DeveloperMessage = fmt.Sprintf("%s: %v", format, err)
+		h.JSON(http.StatusNotAcceptable, res)
+		return
+	}
+	h.Blob(code, format, body)
+}
+
+type acceptSpec struct {
+	value string
+	q     float64
+}
+
+// negotiateFormat return the first offer matching the highest quality of accept
+func negotiateFormat(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	specs := []acceptSpec{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			specs = append(specs, acceptSpec{value: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(specs, func(i, j int) bool { return specs[i].q > specs[j].q })
+
+	for _, spec := range specs {
+		for _, offer := range offers {
+			if matchMediaType(spec.value, offer) {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+func matchMediaType(spec, offer string) bool {
+	if spec == "*/*" || spec == offer {
+		return true
+	}
+	if strings.HasSuffix(spec, "/*") {
+		return strings.HasPrefix(offer, strings.TrimSuffix(spec, "*"))
+	}
+	// text/xml and application/x-msgpack are common aliases
+	switch spec {
+	case "text/xml":
+		return offer == constants.ContentTypeXML
+	case "application/x-msgpack":
+		return offer == constants.ContentTypeMsgPack
+	}
+	return false
+}
@@ -1,91 +1,65 @@
 package ms
 
 import (
-	"context"
-	"fmt"
-	"log"
 	"net/http"
 	"os"
-	"os/signal"
-	"sync"
-	"syscall"
 
 	"github.com/gorilla/mux"
-	"github.com/sing3demons/go-service/logger"
-	"github.com/sing3demons/go-service/middleware"
-
 	"go.uber.org/zap"
 )
 
+// microservice is the legacy entry point with raw http handlers,
+// it is an adapter over application so both share middleware, metrics, health checks and shutdown
 type microservice struct {
-	r   *mux.Router
+	app *application
 	Log *zap.Logger
 }
 
+// NewMicroservice create an application listening on PORT
 func NewMicroservice() *microservice {
-	r := mux.NewRouter()
-	logg := logger.NewLogger()
-	r.Use(middleware.Logger)
-	return &microservice{r, logg}
+	app := NewApplication(Config{
+		Addr: os.Getenv("PORT"),
+		Env:  os.Getenv("APP_ENV"),
+	})
+	return &microservice{app: app, Log: app.logger}
 }
 
-func (m *microservice) Start() {
-	port := os.Getenv("PORT")
-	svc := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: m.r,
-	}
+// Application return the underlying application
+func (m *microservice) Application() *application {
+	return m.app
+}
 
-	stopServer := make(chan os.Signal, 1)
-	signal.Notify(stopServer, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(stopServer)
+// Start run the application until it receive a stop signal
+func (m *microservice) Start() error {
 	defer m.Log.Sync()
-	// channel to listen for errors coming from the listener.
-	serverErrors := make(chan error, 1)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func(wg *sync.WaitGroup) {
-		defer wg.Done()
-		m.Log.Info(fmt.Sprintf("server is listening on port %s", port))
-		serverErrors <- svc.ListenAndServe()
-	}(&wg)
 
-	// blocking run and waiting for shutdown.
-	select {
-	case err := <-serverErrors:
-		log.Fatalf("error: starting rest api server: %v\n", err)
-	case <-stopServer:
-		fmt.Println("server received stop signal")
-		// asking listener to shutdown
-		err := svc.Shutdown(context.Background())
-		if err != nil {
-			log.Fatalf("graceful shutdown did not complete: %v\n", err)
-		}
-		wg.Wait()
-		fmt.Println("server was shut down gracefully")
+	err := m.app.Run()
+	if err != nil {
+		m.Log.Error("server stopped with error", zap.Error(err))
 	}
+	return err
 }
 
 func (m *microservice) Use(middleware func(http.Handler) http.Handler) {
-	m.r.Use(middleware)
+	m.app.Use(middleware)
 }
 
 func (m *microservice) GET(path string, f func(http.ResponseWriter, *http.Request)) *mux.Route {
-	return m.r.HandleFunc(path, f).Methods(http.MethodGet)
+	return m.app.HandleFunc(http.MethodGet, path, f)
 }
 
 func (m *microservice) POST(path string, f func(http.ResponseWriter, *http.Request)) *mux.Route {
-	return m.r.HandleFunc(path, f).Methods(http.MethodPost)
+	return m.app.HandleFunc(http.MethodPost, path, f)
 }
 
 func (m *microservice) PUT(path string, f func(http.ResponseWriter, *http.Request)) *mux.Route {
-	return m.r.HandleFunc(path, f).Methods(http.MethodPut)
+	return m.app.HandleFunc(http.MethodPut, path, f)
 }
 
 func (m *microservice) DELETE(path string, f func(http.ResponseWriter, *http.Request)) *mux.Route {
-	return m.r.HandleFunc(path, f).Methods(http.MethodDelete)
+	return m.app.HandleFunc(http.MethodDelete, path, f)
 }
 
 func (m *microservice) PATCH(path string, f func(http.ResponseWriter, *http.Request)) *mux.Route {
-	return m.r.HandleFunc(path, f).Methods(http.MethodPatch)
+	return m.app.HandleFunc(http.MethodPatch, path, f)
 }
@@ -0,0 +1,151 @@
+package ms
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enable mTLS, client certificates must be signed by this CA
+	ClientCAFile string
+	// ClientAuthOptional only verify client certificates when they are presented
+	ClientAuthOptional bool
+}
+
+func (t TLSConfig) enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+type ServerConfig struct {
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+func (s ServerConfig) withDefaults() ServerConfig {
+	if s.ReadTimeout <= 0 {
+		s.ReadTimeout = 10 * time.Second
+	}
+	if s.WriteTimeout <= 0 {
+		s.WriteTimeout = 30 * time.Second
+	}
+	if s.IdleTimeout <= 0 {
+		s.IdleTimeout = time.Minute
+	}
+	if s.ShutdownTimeout <= 0 {
+		s.ShutdownTimeout = 5 * time.Second
+	}
+	return s
+}
+
+type server struct {
+	name string
+	srv  *http.Server
+	tls  TLSConfig
+}
+
+func (s *server) serve() error {
+	var err error
+	if s.tls.enabled() {
+		err = s.srv.ListenAndServeTLS(s.tls.CertFile, s.tls.KeyFile)
+	} else {
+		err = s.srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return fmt.Errorf("%s server: %w", s.name, err)
+}
+
+// newServers create the public server and the admin server when AdminAddr is set
+func (app *application) newServers() ([]*server, error) {
+	cfg := app.config.Server.withDefaults()
+
+	handler := app.handler()
+	if app.config.HTTP2 && !app.config.TLS.enabled() {
+		// HTTP/2 without TLS, HTTP/2 over TLS is negotiated by net/http
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	public := &server{
+		name: "public",
+		tls:  app.config.TLS,
+		srv: &http.Server{
+			Addr:         fmt.Sprintf(":%s", app.config.Addr),
+			Handler:      handler,
+			WriteTimeout: cfg.WriteTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		},
+	}
+
+	if app.config.TLS.enabled() {
+		tlsConfig, err := newTLSConfig(app.config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		public.srv.TLSConfig = tlsConfig
+	}
+
+	servers := []*server{public}
+	if app.admin != nil {
+		servers = append(servers, &server{
+			name: "admin",
+			srv: &http.Server{
+				Addr:         fmt.Sprintf(":%s", app.config.AdminAddr),
+				Handler:      app.admin,
+				ReadTimeout:  cfg.ReadTimeout,
+				IdleTimeout:  cfg.IdleTimeout,
+				WriteTimeout: 0, // pprof profiles stream for longer than the write timeout
+			},
+		})
+	}
+
+	return servers, nil
+}
+
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificate found in %s", cfg.ClientCAFile)
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if cfg.ClientAuthOptional {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// registerPprof mount the runtime profiling endpoints, they must only be exposed on the admin port
+func registerPprof(r *mux.Router) {
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+}
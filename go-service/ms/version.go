@@ -0,0 +1,65 @@
+package ms
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version of the service, set at build time with
+// -ldflags "-X github.com/sing3demons/go-service/ms.Version=1.0.0"
+var Version = "dev"
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: Version, GoVersion: runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = bi.Main.Path
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+type memoryStats struct {
+	HeapAllocMB  float64 `json:"heap_alloc_mb"`
+	HeapSysMB    float64 `json:"heap_sys_mb"`
+	SysMB        float64 `json:"sys_mb"`
+	NumGC        uint32  `json:"num_gc"`
+	NumGoroutine int     `json:"num_goroutine"`
+}
+
+func readMemoryStats() memoryStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	const mb = 1024 * 1024
+	return memoryStats{
+		HeapAllocMB:  float64(m.HeapAlloc) / mb,
+		HeapSysMB:    float64(m.HeapSys) / mb,
+		SysMB:        float64(m.Sys) / mb,
+		NumGC:        m.NumGC,
+		NumGoroutine: runtime.NumGoroutine(),
+	}
+}
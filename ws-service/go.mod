@@ -2,4 +2,4 @@ module github.com/sing3demons/ws-service
 
 go 1.22.5
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3